@@ -5,14 +5,20 @@ import (
 	"net/http"
 
 	"github.com/christowolf/server-playground/upload"
+	"github.com/christowolf/server-playground/upload/localfs"
 )
 
 // Main entry point of server playground.
 func main() {
+	// Instantiate the default storage backend: the local filesystem.
+	store, err := localfs.New(upload.UploadDir)
+	if err != nil {
+		log.Fatal(err)
+	}
 	// Instantiate a mux for registering handlers.
 	mux := http.NewServeMux()
 	// Register the upload API route.
-	mux.Handle(upload.ApiUrl, upload.ApiEndpoint())
+	mux.Handle(upload.ApiUrl, upload.NewHandler(store))
 	// Start the server.
 	log.Fatal(http.ListenAndServe(":8080", mux))
 }
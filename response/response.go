@@ -8,6 +8,7 @@ import (
 	"mime"
 	"net/http"
 	"path/filepath"
+	"time"
 )
 
 // JsonDto is the response DTO for JSON responses.
@@ -21,6 +22,10 @@ type JsonDto struct {
 	Message     string   `json:"message"`
 	ErrorString string   `json:"error,omitempty"`
 	File        *FileDto `json:"file,omitempty"`
+	// Files holds every file an upload stored, in order, for requests that
+	// store more than one. File is always set to Files[0] when Files is
+	// non-empty, so single-file callers can keep reading File alone.
+	Files []*FileDto `json:"files,omitempty"`
 }
 
 // FileDto is a DTO for defining the JSON schema of
@@ -30,6 +35,29 @@ type JsonDto struct {
 type FileDto struct {
 	Name     string `json:"name"`
 	MimeType string `json:"mime_type"`
+	// URL is a location the file can be retrieved from directly, such as a
+	// pre-signed download URL. It is omitted if the storage backend has none
+	// to offer.
+	URL string `json:"url,omitempty"`
+}
+
+// ListDto is the response DTO for a directory-style listing of stored
+// objects under some prefix.
+type ListDto struct {
+	// Entries are the objects found directly under the listed prefix.
+	Entries []EntryDto `json:"entries"`
+	// CommonPrefixes are pseudo-directories found under the listed prefix,
+	// derived from "/" separators in keys.
+	CommonPrefixes []string `json:"common_prefixes,omitempty"`
+}
+
+// EntryDto is a DTO for one object in a ListDto.
+type EntryDto struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mime_type,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	UploadTime time.Time `json:"upload_time"`
 }
 
 // NewFileDto creates a new FileDto instance.
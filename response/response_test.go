@@ -108,6 +108,18 @@ func TestNewFileDto(t *testing.T) {
 	}
 }
 
+// TestListDtoMarshalUnmarshalProperty applies property based testing
+// to probe for inputs which provoke marshalling errors or
+// mismatches between the original and marshalled + unmarshalled ListDto.
+func TestListDtoMarshalUnmarshalProperty(t *testing.T) {
+	t.Parallel()
+	c := &quick.Config{MaxCount: 100000}
+	f := listDtoMarshalUnmarshalPropertySpec
+	if err := quick.Check(f, c); err != nil {
+		t.Error(err)
+	}
+}
+
 // TestError tests the writing of error responses.
 func TestError(t *testing.T) {
 	t.Parallel()
@@ -166,6 +178,36 @@ func marshalUnmarshalPropertySpec(status uint16, message, errorString, name stri
 	return err == nil && reflect.DeepEqual(got, dto)
 }
 
+// listDtoMarshalUnmarshalPropertySpec is the property specification used for
+// property based testing of ListDto marshal + unmarshalling. UploadTime is
+// not generated: it stays at its zero value and is left out of the
+// comparison.
+func listDtoMarshalUnmarshalPropertySpec(name string, size int64, mimeType, sha256 string, commonPrefixes []string) bool {
+	dto := &response.ListDto{
+		Entries:        []response.EntryDto{{Name: name, Size: size, MimeType: mimeType, SHA256: sha256}},
+		CommonPrefixes: commonPrefixes,
+	}
+	jsonData, err := json.Marshal(dto)
+	if err != nil {
+		return false
+	}
+	got := &response.ListDto{}
+	if err := json.Unmarshal(jsonData, got); err != nil {
+		return false
+	}
+	if len(got.Entries) != 1 {
+		return false
+	}
+	gotEntry, wantEntry := got.Entries[0], dto.Entries[0]
+	return gotEntry.Name == wantEntry.Name &&
+		gotEntry.Size == wantEntry.Size &&
+		gotEntry.MimeType == wantEntry.MimeType &&
+		gotEntry.SHA256 == wantEntry.SHA256 &&
+		// CommonPrefixes is "omitempty", so a nil and an empty slice both
+		// round-trip to nil; compare contents rather than nil-ness.
+		strings.Join(got.CommonPrefixes, "\x00") == strings.Join(dto.CommonPrefixes, "\x00")
+}
+
 // errorPropertySpec is the property specification
 // used for property based testing of error responses.
 func errorPropertySpec(status uint16, errorString string) bool {
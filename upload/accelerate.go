@@ -0,0 +1,251 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// copyBufferSize bounds how much of a part is held in memory at once while
+// streaming it to storage, regardless of how large the part itself is.
+const copyBufferSize = 32 * 1024
+
+// FileRef references a file that Accelerate has already streamed to storage
+// in place of the original multipart file content.
+type FileRef struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// PartHandler is invoked once per file part encountered by Accelerate,
+// after its bytes have been streamed to storage.
+type PartHandler func(fieldName, fileName string, ref FileRef) error
+
+// WriterFactory creates the destination a file part is streamed into. It
+// returns the writer along with the path that should be recorded in the
+// part's FileRef.
+type WriterFactory func(fieldName, fileName string) (w io.WriteCloser, path string, err error)
+
+// acceleratorOptions holds the configuration built up by Option values.
+type acceleratorOptions struct {
+	uploadDir        string
+	maxFileSize      int64
+	allowedMIMETypes []string
+	partHandler      PartHandler
+	newWriter        WriterFactory
+}
+
+// Option configures the behavior of Accelerate.
+type Option func(*acceleratorOptions)
+
+// WithUploadDir overrides the directory file parts are streamed into.
+// Defaults to UploadDir.
+func WithUploadDir(dir string) Option {
+	return func(o *acceleratorOptions) { o.uploadDir = dir }
+}
+
+// WithMaxFileSize caps the size of any single file part. A part exceeding the
+// limit aborts the request with an error. Zero, the default, means unlimited.
+func WithMaxFileSize(n int64) Option {
+	return func(o *acceleratorOptions) { o.maxFileSize = n }
+}
+
+// WithAllowedMIMETypes restricts accepted file parts to the given MIME types,
+// matched against the part's declared Content-Type. A type ending in "/*"
+// matches any subtype. No restriction, the default, allows every type.
+func WithAllowedMIMETypes(types ...string) Option {
+	return func(o *acceleratorOptions) { o.allowedMIMETypes = types }
+}
+
+// WithPartHandler registers a callback invoked once per file part, after its
+// bytes have been streamed to storage.
+func WithPartHandler(h PartHandler) Option {
+	return func(o *acceleratorOptions) { o.partHandler = h }
+}
+
+// WithWriterFactory overrides where file bytes are streamed to, replacing the
+// default of creating a file under the upload directory.
+func WithWriterFactory(f WriterFactory) Option {
+	return func(o *acceleratorOptions) { o.newWriter = f }
+}
+
+// Accelerate returns middleware that rewrites an incoming multipart/form-data
+// request so next never sees raw file bytes: every part with a non-empty
+// file name is streamed straight to storage with a bounded buffer, then
+// replaced in the request seen by next with a FileRef (path, size, sha256)
+// encoded as that field's value. Non-file fields are copied through
+// unchanged. Requests that are not multipart/form-data are passed through
+// as-is.
+//
+// This mirrors GitLab Workhorse's Multipart/Accelerate middleware: it lets a
+// slow, memory-hungry upload be handled once, in front of routes that only
+// need to know where a file ended up rather than read its bytes.
+func Accelerate(next http.Handler, opts ...Option) http.Handler {
+	cfg := &acceleratorOptions{uploadDir: UploadDir}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rewritten, err := rewriteMultipart(r, cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, rewritten)
+	})
+}
+
+// rewriteMultipart walks r's multipart body part by part, streaming file
+// parts to storage and copying everything else into a replacement body, then
+// returns a shallow clone of r with that body installed.
+func rewriteMultipart(r *http.Request, cfg *acceleratorOptions) (*http.Request, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("upload: parsing content type: %w", err)
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("upload: reading part: %w", err)
+		}
+		if part.FileName() == "" {
+			if err := copyValuePart(writer, part); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := cfg.streamFilePart(writer, part); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("upload: closing rewritten body: %w", err)
+	}
+	out := r.Clone(r.Context())
+	out.Body = io.NopCloser(body)
+	out.ContentLength = int64(body.Len())
+	out.Header.Set("Content-Type", writer.FormDataContentType())
+	return out, nil
+}
+
+// copyValuePart copies a non-file part verbatim into the rewritten body.
+func copyValuePart(writer *multipart.Writer, part *multipart.Part) error {
+	dst, err := writer.CreatePart(textproto.MIMEHeader{"Content-Disposition": part.Header["Content-Disposition"]})
+	if err != nil {
+		return fmt.Errorf("upload: recreating field %q: %w", part.FormName(), err)
+	}
+	if _, err := io.CopyBuffer(dst, part, make([]byte, copyBufferSize)); err != nil {
+		return fmt.Errorf("upload: copying field %q: %w", part.FormName(), err)
+	}
+	return nil
+}
+
+// streamFilePart validates and streams a single file part to storage, then
+// writes its FileRef into writer as that field's new value. If anything
+// after the destination is created fails -- the copy itself, or the
+// max-size check -- the partial file is removed rather than left behind.
+func (cfg *acceleratorOptions) streamFilePart(writer *multipart.Writer, part *multipart.Part) (err error) {
+	if len(cfg.allowedMIMETypes) > 0 && !mimeTypeAllowed(part.Header.Get("Content-Type"), cfg.allowedMIMETypes) {
+		return fmt.Errorf("upload: content type %q not allowed for field %q", part.Header.Get("Content-Type"), part.FormName())
+	}
+	newWriter := cfg.newWriter
+	if newWriter == nil {
+		newWriter = defaultWriter(cfg.uploadDir)
+	}
+	dst, path, err := newWriter(part.FormName(), part.FileName())
+	if err != nil {
+		return fmt.Errorf("upload: opening destination for %q: %w", part.FileName(), err)
+	}
+	defer dst.Close()
+	defer func() {
+		if err != nil {
+			if rmErr := os.Remove(path); rmErr != nil && !os.IsNotExist(rmErr) {
+				log.Printf("upload: removing partial upload %q: %v", path, rmErr)
+			}
+		}
+	}()
+	hash := sha256.New()
+	src := io.Reader(part)
+	if cfg.maxFileSize > 0 {
+		src = io.LimitReader(part, cfg.maxFileSize+1)
+	}
+	size, err := io.CopyBuffer(io.MultiWriter(dst, hash), src, make([]byte, copyBufferSize))
+	if err != nil {
+		return fmt.Errorf("upload: streaming %q: %w", part.FileName(), err)
+	}
+	if cfg.maxFileSize > 0 && size > cfg.maxFileSize {
+		return fmt.Errorf("upload: %q exceeds max file size of %d bytes", part.FileName(), cfg.maxFileSize)
+	}
+	ref := FileRef{Path: path, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}
+	if cfg.partHandler != nil {
+		if err := cfg.partHandler(part.FormName(), part.FileName(), ref); err != nil {
+			return fmt.Errorf("upload: part handler for %q: %w", part.FileName(), err)
+		}
+	}
+	refJSON, err := json.Marshal(ref)
+	if err != nil {
+		return fmt.Errorf("upload: marshaling file reference: %w", err)
+	}
+	if err := writer.WriteField(part.FormName(), string(refJSON)); err != nil {
+		return fmt.Errorf("upload: writing file reference: %w", err)
+	}
+	return nil
+}
+
+// defaultWriter returns a WriterFactory that creates files under dir, named
+// after a random UUID with fileName's extension preserved.
+func defaultWriter(dir string) WriterFactory {
+	return func(_, fileName string) (io.WriteCloser, string, error) {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, "", err
+		}
+		path := filepath.Join(dir, uuid.NewString()+filepath.Ext(fileName))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return nil, "", err
+		}
+		return f, path, nil
+	}
+}
+
+// mimeTypeAllowed reports whether contentType matches one of allowed, where
+// an allowed entry ending in "/*" matches any subtype of that type.
+func mimeTypeAllowed(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	for _, a := range allowed {
+		if a == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(a, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
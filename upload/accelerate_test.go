@@ -0,0 +1,203 @@
+package upload_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/christowolf/server-playground/upload"
+)
+
+// TestAccelerateStreamsFileParts pushes a multipart form with two file parts
+// and interleaved text fields through Accelerate, and checks that next sees
+// the text fields untouched and the file fields replaced by FileRef JSON
+// pointing at files that were actually written to disk.
+func TestAccelerateStreamsFileParts(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt": "content of file a",
+		"b.txt": "content of file b, a bit longer than the first one",
+	}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("title", "my upload"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	fwA, _ := writer.CreateFormFile("fileA", "a.txt")
+	io.Copy(fwA, strings.NewReader(files["a.txt"]))
+	if err := writer.WriteField("description", "two files"); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	fwB, _ := writer.CreateFormFile("fileB", "b.txt")
+	io.Copy(fwB, strings.NewReader(files["b.txt"]))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	var gotPaths []string
+	sut := upload.Accelerate(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := r.FormValue("title"); got != "my upload" {
+			t.Errorf("expected title: %v, got: %v", "my upload", got)
+		}
+		if got := r.FormValue("description"); got != "two files" {
+			t.Errorf("expected description: %v, got: %v", "two files", got)
+		}
+		for field, fileName := range map[string]string{"fileA": "a.txt", "fileB": "b.txt"} {
+			refJSON := r.FormValue(field)
+			if refJSON == "" {
+				t.Fatalf("expected a file reference for field: %v", field)
+			}
+			var ref upload.FileRef
+			if err := json.Unmarshal([]byte(refJSON), &ref); err != nil {
+				t.Fatalf("expected valid file reference JSON, got error: %v", err)
+			}
+			checkStoredFile(t, ref, files[fileName])
+			gotPaths = append(gotPaths, ref.Path)
+		}
+	}), upload.WithUploadDir(dir))
+	sut.ServeHTTP(w, r)
+
+	for _, path := range gotPaths {
+		if !strings.HasPrefix(path, dir) {
+			t.Errorf("expected file under: %v, got: %v", dir, path)
+		}
+	}
+}
+
+// TestAccelerateStreamsLargeFileWithBoundedBuffer pushes a file large enough
+// that naive buffering would be noticeable, and checks the copy still
+// completes correctly. Accelerate never holds more than a small, fixed
+// buffer per part in memory (see copyBufferSize), so this exercises that
+// path regardless of the file's size.
+func TestAccelerateStreamsLargeFileWithBoundedBuffer(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	const size = 8 << 20 // 8 MiB, well above any reasonable fixed buffer.
+	content := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormFile("file", "large.bin")
+	io.Copy(fw, bytes.NewReader(content))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	sut := upload.Accelerate(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		var ref upload.FileRef
+		if err := json.Unmarshal([]byte(r.FormValue("file")), &ref); err != nil {
+			t.Fatalf("expected valid file reference JSON, got error: %v", err)
+		}
+		checkStoredFile(t, ref, string(content))
+	}), upload.WithUploadDir(dir))
+	sut.ServeHTTP(w, r)
+}
+
+// TestAccelerateRejectsDisallowedMIMEType checks that a file part whose
+// Content-Type is not in the allowlist is rejected before it reaches next.
+func TestAccelerateRejectsDisallowedMIMEType(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreatePart(map[string][]string{
+		"Content-Disposition": {`form-data; name="file"; filename="a.exe"`},
+		"Content-Type":        {"application/x-msdownload"},
+	})
+	io.Copy(fw, strings.NewReader("not an image"))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	called := false
+	sut := upload.Accelerate(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		called = true
+	}), upload.WithUploadDir(dir), upload.WithAllowedMIMETypes("image/*"))
+	sut.ServeHTTP(w, r)
+
+	if called {
+		t.Error("expected next handler not to be called")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code: %v, got: %v", http.StatusBadRequest, w.Code)
+	}
+}
+
+// TestAccelerateRejectsOversizeFileRemovesPartial checks that a file part
+// exceeding WithMaxFileSize is rejected before it reaches next, and that the
+// partial file streamed to disk before the size cap was noticed is removed
+// rather than left behind.
+func TestAccelerateRejectsOversizeFileRemovesPartial(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormFile("file", "big.bin")
+	io.Copy(fw, strings.NewReader(strings.Repeat("x", 1<<20)))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	called := false
+	sut := upload.Accelerate(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		called = true
+	}), upload.WithUploadDir(dir), upload.WithMaxFileSize(1024))
+	sut.ServeHTTP(w, r)
+
+	if called {
+		t.Error("expected next handler not to be called")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status code: %v, got: %v", http.StatusBadRequest, w.Code)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no partial files left in %v, got: %v", dir, entries)
+	}
+}
+
+// checkStoredFile checks that the file referenced by ref was written to disk
+// with the expected content, size and hash.
+func checkStoredFile(t *testing.T, ref upload.FileRef, wantContent string) {
+	t.Helper()
+	got, err := os.ReadFile(ref.Path)
+	if err != nil {
+		t.Fatalf("expected file: %v, got error: %v", ref.Path, err)
+	}
+	if string(got) != wantContent {
+		t.Errorf("expected file content: %v, got: %v", wantContent, string(got))
+	}
+	if ref.Size != int64(len(wantContent)) {
+		t.Errorf("expected file size: %v, got: %v", len(wantContent), ref.Size)
+	}
+	sum := sha256.Sum256([]byte(wantContent))
+	if ref.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected sha256: %v, got: %v", hex.EncodeToString(sum[:]), ref.SHA256)
+	}
+}
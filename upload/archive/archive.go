@@ -0,0 +1,169 @@
+// Package archive provides ZIP archive introspection and single-entry
+// extraction for uploaded files.
+//
+// It generates a compact metadata sidecar for an uploaded zip file -- a
+// gzip-compressed stream of per-entry records, borrowed from the design of
+// GitLab Workhorse's artifacts package -- so callers can answer "what's in
+// this zip" without re-parsing the (possibly large) archive, and it exposes
+// ExtractEntry to stream a single entry's decompressed contents back out.
+package archive
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// MetaSuffix is the file extension of the metadata sidecar GenerateMeta
+// writes alongside a stored zip file.
+const MetaSuffix = ".meta.gz"
+
+// metaMagic and metaVersion identify the sidecar format, written as a small
+// header ahead of the gzip stream, so a future incompatible format can be
+// told apart from a corrupt sidecar rather than failing to gzip.NewReader.
+const (
+	metaMagic   = "ZMETA"
+	metaVersion = uint16(1)
+)
+
+// Entry describes one file stored in a zip archive.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    uint64    `json:"size"`
+	Mode    uint32    `json:"mode"`
+	CRC32   uint32    `json:"crc32"`
+	ModTime time.Time `json:"modtime"`
+	Comment string    `json:"comment,omitempty"`
+}
+
+// GenerateMeta writes a metadata sidecar for zr to w: a small header
+// identifying the format and version, followed by a gzip-compressed stream
+// of newline-delimited JSON Entry records, one per zip entry. Entries whose
+// path would zip-slip are skipped, since ExtractEntry could never serve them
+// anyway.
+func GenerateMeta(w io.Writer, zr *zip.Reader) error {
+	if err := writeHeader(w); err != nil {
+		return err
+	}
+	gw := gzip.NewWriter(w)
+	enc := json.NewEncoder(gw)
+	for _, f := range zr.File {
+		if !safePath(f.Name) {
+			continue
+		}
+		entry := Entry{
+			Path:    f.Name,
+			Size:    f.UncompressedSize64,
+			Mode:    uint32(f.Mode()),
+			CRC32:   f.CRC32,
+			ModTime: f.Modified,
+			Comment: f.Comment,
+		}
+		if err := enc.Encode(&entry); err != nil {
+			gw.Close()
+			return fmt.Errorf("archive: encoding entry %q: %w", f.Name, err)
+		}
+	}
+	return gw.Close()
+}
+
+// ReadMeta reads back the sidecar GenerateMeta wrote to r.
+func ReadMeta(r io.Reader) ([]Entry, error) {
+	if err := readHeader(r); err != nil {
+		return nil, err
+	}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("archive: opening meta gzip stream: %w", err)
+	}
+	var entries []Entry
+	dec := json.NewDecoder(gr)
+	for {
+		var entry Entry
+		if err := dec.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("archive: decoding meta entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	// The gzip reader checks the stream's trailing checksum and size when it
+	// reaches the end of the stream, so a damaged footer already fails the
+	// Decode loop above; gr.Close reports any error the decompressor is
+	// still holding.
+	if err := gr.Close(); err != nil {
+		return nil, fmt.Errorf("archive: validating meta gzip stream: %w", err)
+	}
+	return entries, nil
+}
+
+// ExtractEntry locates the zip entry at entryPath within zr and returns a
+// reader for its decompressed contents, along with the matched *zip.File.
+// It rejects zip-slip paths (absolute paths, or paths escaping the archive
+// root via ".." segments), the same way GenerateMeta does.
+func ExtractEntry(zr *zip.Reader, entryPath string) (io.ReadCloser, *zip.File, error) {
+	if !safePath(entryPath) {
+		return nil, nil, fmt.Errorf("archive: unsafe entry path %q", entryPath)
+	}
+	for _, f := range zr.File {
+		if f.Name != entryPath {
+			continue
+		}
+		if !safePath(f.Name) {
+			return nil, nil, fmt.Errorf("archive: unsafe entry path %q", f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("archive: opening entry %q: %w", entryPath, err)
+		}
+		return rc, f, nil
+	}
+	return nil, nil, fmt.Errorf("archive: entry %q not found", entryPath)
+}
+
+// writeHeader writes the sidecar format header to w.
+func writeHeader(w io.Writer) error {
+	if _, err := io.WriteString(w, metaMagic); err != nil {
+		return fmt.Errorf("archive: writing meta header: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, metaVersion); err != nil {
+		return fmt.Errorf("archive: writing meta version: %w", err)
+	}
+	return nil
+}
+
+// readHeader reads and validates the sidecar format header from r.
+func readHeader(r io.Reader) error {
+	magic := make([]byte, len(metaMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return fmt.Errorf("archive: reading meta header: %w", err)
+	}
+	if string(magic) != metaMagic {
+		return fmt.Errorf("archive: unrecognized meta header %q", magic)
+	}
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return fmt.Errorf("archive: reading meta version: %w", err)
+	}
+	if version != metaVersion {
+		return fmt.Errorf("archive: unsupported meta version %d", version)
+	}
+	return nil
+}
+
+// safePath reports whether p is safe to record or extract: neither absolute
+// nor escaping its own root via ".." segments (zip-slip).
+func safePath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") {
+		return false
+	}
+	cleaned := path.Clean(p)
+	return cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
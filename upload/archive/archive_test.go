@@ -0,0 +1,189 @@
+// Package archive_test provides a test suite for the archive package.
+package archive_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/christowolf/server-playground/upload/archive"
+)
+
+// buildZip returns an in-memory zip archive containing the given path ->
+// content entries, along with a *zip.Reader over it.
+func buildZip(t *testing.T, entries map[string]string) (*bytes.Buffer, *zip.Reader) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for path, content := range entries {
+		fw, err := zw.Create(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return buf, zr
+}
+
+// TestGenerateReadMeta tests that ReadMeta reports back the entries
+// GenerateMeta wrote for a zip containing nested paths and a non-ASCII
+// filename.
+func TestGenerateReadMeta(t *testing.T) {
+	t.Parallel()
+	entries := map[string]string{
+		"readme.txt":             "hello",
+		"nested/deep/report.txt": "report content",
+		"non-ascii/日本語ファイル.txt":  "unicode content",
+	}
+	_, zr := buildZip(t, entries)
+
+	meta := &bytes.Buffer{}
+	if err := archive.GenerateMeta(meta, zr); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	got, err := archive.ReadMeta(meta)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("expected %v entries, got: %v", len(entries), got)
+	}
+	for _, entry := range got {
+		content, ok := entries[entry.Path]
+		if !ok {
+			t.Errorf("unexpected entry path: %v", entry.Path)
+			continue
+		}
+		if entry.Size != uint64(len(content)) {
+			t.Errorf("expected size: %v, got: %v", len(content), entry.Size)
+		}
+	}
+}
+
+// TestGenerateMetaSkipsZipSlip tests that GenerateMeta omits entries whose
+// path would escape the archive root.
+func TestGenerateMetaSkipsZipSlip(t *testing.T) {
+	t.Parallel()
+	_, zr := buildZip(t, map[string]string{"safe.txt": "safe"})
+	// zip.Writer.Create does not let us inject a zip-slip path directly, so
+	// rewrite the central directory entry's name in place instead.
+	zr.File[0].Name = "../escape.txt"
+
+	meta := &bytes.Buffer{}
+	if err := archive.GenerateMeta(meta, zr); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	got, err := archive.ReadMeta(meta)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("expected no entries, got: %v", got)
+	}
+}
+
+// TestExtractEntry tests extracting a nested entry and a non-ASCII-named
+// entry by path.
+func TestExtractEntry(t *testing.T) {
+	t.Parallel()
+	entries := map[string]string{
+		"nested/deep/report.txt": "report content",
+		"non-ascii/日本語ファイル.txt":  "unicode content",
+	}
+	_, zr := buildZip(t, entries)
+
+	for path, want := range entries {
+		path, want := path, want
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+			rc, f, err := archive.ExtractEntry(zr, path)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			defer rc.Close()
+			if f.Name != path {
+				t.Errorf("expected entry name: %v, got: %v", path, f.Name)
+			}
+			got, err := io.ReadAll(rc)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if string(got) != want {
+				t.Errorf("expected content: %v, got: %v", want, string(got))
+			}
+		})
+	}
+}
+
+// TestExtractEntryRejectsZipSlip tests that ExtractEntry refuses to extract
+// an entry path that would escape the archive root.
+func TestExtractEntryRejectsZipSlip(t *testing.T) {
+	t.Parallel()
+	_, zr := buildZip(t, map[string]string{"safe.txt": "safe"})
+	for _, path := range []string{"../escape.txt", "/etc/passwd", "a/../../b"} {
+		path := path
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+			if _, _, err := archive.ExtractEntry(zr, path); err == nil {
+				t.Errorf("expected an error for unsafe path: %v", path)
+			}
+		})
+	}
+}
+
+// TestExtractEntryNotFound tests that ExtractEntry reports an error for a
+// path not present in the archive.
+func TestExtractEntryNotFound(t *testing.T) {
+	t.Parallel()
+	_, zr := buildZip(t, map[string]string{"safe.txt": "safe"})
+	if _, _, err := archive.ExtractEntry(zr, "missing.txt"); err == nil {
+		t.Error("expected an error for a missing entry")
+	}
+}
+
+// TestReadMetaTruncated tests that ReadMeta reports an error, rather than
+// panicking, on a truncated sidecar.
+func TestReadMetaTruncated(t *testing.T) {
+	t.Parallel()
+	_, zr := buildZip(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	full := &bytes.Buffer{}
+	if err := archive.GenerateMeta(full, zr); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, n := range []int{0, 1, len(archive.MetaSuffix), full.Len() / 2} {
+		n := n
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+			truncated := bytes.NewReader(full.Bytes()[:n])
+			if _, err := archive.ReadMeta(truncated); err == nil {
+				t.Errorf("expected an error for a sidecar truncated to %v bytes", n)
+			}
+		})
+	}
+}
+
+// TestReadMetaCorrupted tests that ReadMeta reports an error when the gzip
+// stream's trailing checksum no longer matches its content.
+func TestReadMetaCorrupted(t *testing.T) {
+	t.Parallel()
+	_, zr := buildZip(t, map[string]string{"a.txt": "a", "b.txt": "b"})
+	full := &bytes.Buffer{}
+	if err := archive.GenerateMeta(full, zr); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	corrupted := full.Bytes()
+	corrupted[len(corrupted)-1] ^= 0xFF
+	if _, err := archive.ReadMeta(bytes.NewReader(corrupted)); err == nil {
+		t.Error("expected an error for a corrupted sidecar")
+	}
+}
@@ -0,0 +1,214 @@
+package upload
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/christowolf/server-playground/response"
+)
+
+// TicketHeader is the HTTP header an upload ticket is carried in, both when
+// Authorize issues one and when RequireTicket expects one.
+const TicketHeader = "X-Upload-Ticket"
+
+// Authorization describes the terms under which a PreAuthorizer allows an
+// upload to proceed.
+type Authorization struct {
+	// MaxSize caps the number of bytes the request body may contain. Zero
+	// means unlimited.
+	MaxSize int64
+	// AllowedMIMETypes restricts the upload to the given MIME types. A nil
+	// slice means unrestricted.
+	AllowedMIMETypes []string
+	// Key is the storage key or prefix the upload is allowed to target.
+	Key string
+	// TempPath is a path the caller may stage the upload under before it is
+	// committed to its final Key.
+	TempPath string
+	// ContentSHA256 is the expected sha256 of the uploaded content, hex
+	// encoded, if known ahead of time. Empty means unknown.
+	ContentSHA256 string
+}
+
+// PreAuthorizer decides whether an incoming upload request is allowed to
+// proceed, before its body is read.
+type PreAuthorizer interface {
+	PreAuthorize(ctx context.Context, r *http.Request) (Authorization, error)
+}
+
+// PreAuthorizerFunc adapts a function to a PreAuthorizer.
+type PreAuthorizerFunc func(ctx context.Context, r *http.Request) (Authorization, error)
+
+// PreAuthorize calls f.
+func (f PreAuthorizerFunc) PreAuthorize(ctx context.Context, r *http.Request) (Authorization, error) {
+	return f(ctx, r)
+}
+
+// TicketClaims are the JWT claims carried by an upload ticket issued by
+// Authorize and validated by RequireTicket.
+type TicketClaims struct {
+	UploadID         string   `json:"upload_id"`
+	Key              string   `json:"key"`
+	MaxSize          int64    `json:"max_size"`
+	AllowedMIMETypes []string `json:"allowed_mime_types,omitempty"`
+	ContentSHA256    string   `json:"content_sha256,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TicketSigner issues and validates JWT-signed upload tickets.
+type TicketSigner struct {
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	expiration time.Duration
+}
+
+// NewHS256TicketSigner returns a TicketSigner that signs and verifies tickets
+// using HS256 with secret, expiring after ttl.
+func NewHS256TicketSigner(secret []byte, ttl time.Duration) *TicketSigner {
+	return &TicketSigner{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret, expiration: ttl}
+}
+
+// NewRS256TicketSigner returns a TicketSigner that signs tickets with priv
+// and verifies them with pub, using RS256, expiring after ttl.
+func NewRS256TicketSigner(priv *rsa.PrivateKey, pub *rsa.PublicKey, ttl time.Duration) *TicketSigner {
+	return &TicketSigner{method: jwt.SigningMethodRS256, signKey: priv, verifyKey: pub, expiration: ttl}
+}
+
+// issue signs a new ticket for auth.
+func (s *TicketSigner) issue(auth Authorization) (string, error) {
+	now := time.Now()
+	claims := TicketClaims{
+		UploadID:         uuid.NewString(),
+		Key:              auth.Key,
+		MaxSize:          auth.MaxSize,
+		AllowedMIMETypes: auth.AllowedMIMETypes,
+		ContentSHA256:    auth.ContentSHA256,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.expiration)),
+		},
+	}
+	token, err := jwt.NewWithClaims(s.method, claims).SignedString(s.signKey)
+	if err != nil {
+		return "", fmt.Errorf("upload: signing ticket: %w", err)
+	}
+	return token, nil
+}
+
+// parse validates raw and returns its claims.
+func (s *TicketSigner) parse(raw string) (*TicketClaims, error) {
+	claims := &TicketClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != s.method.Alg() {
+			return nil, fmt.Errorf("upload: unexpected signing method %q", t.Header["alg"])
+		}
+		return s.verifyKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload: parsing ticket: %w", err)
+	}
+	return claims, nil
+}
+
+// ticketContextKey is the context key Authorize stores the issued ticket
+// under.
+type ticketContextKey struct{}
+
+// ticketClaimsContextKey is the context key RequireTicket stores validated
+// claims under.
+type ticketClaimsContextKey struct{}
+
+// TicketFromContext returns the upload ticket Authorize injected into ctx,
+// if any.
+func TicketFromContext(ctx context.Context) (string, bool) {
+	ticket, ok := ctx.Value(ticketContextKey{}).(string)
+	return ticket, ok
+}
+
+// TicketClaimsFromContext returns the ticket claims RequireTicket injected
+// into ctx, if any.
+func TicketClaimsFromContext(ctx context.Context) (*TicketClaims, bool) {
+	claims, ok := ctx.Value(ticketClaimsContextKey{}).(*TicketClaims)
+	return claims, ok
+}
+
+// Authorize returns middleware that asks preauth whether an incoming request
+// may proceed before its body is read. On success it enforces the returned
+// size cap via http.MaxBytesReader, issues a short-lived JWT-signed ticket
+// with signer, sets it on the TicketHeader response header, injects it into
+// the request context (retrievable with TicketFromContext), and calls next.
+// On failure it responds with 403 Forbidden and never calls next.
+//
+// This lets the upload server delegate authorization to another service
+// without keeping any state itself: preauth can perform an HTTP callback to
+// that service, and the resulting ticket is everything a later request needs
+// to prove it was authorized, via RequireTicket.
+func Authorize(preauth PreAuthorizer, signer *TicketSigner) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth, err := preauth.PreAuthorize(r.Context(), r)
+			if err != nil {
+				response.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if auth.MaxSize > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, auth.MaxSize)
+			}
+			ticket, err := signer.issue(auth)
+			if err != nil {
+				response.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set(TicketHeader, ticket)
+			ctx := context.WithValue(r.Context(), ticketContextKey{}, ticket)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireTicket returns middleware that validates a client-supplied ticket
+// (see Authorize) carried on the TicketHeader request header, rejecting the
+// request with 401 Unauthorized if it is missing, invalid, or expired. If
+// the ticket's claims carry AllowedMIMETypes and the request is not
+// multipart/form-data, its declared Content-Type is also checked against
+// them, rejecting with 415 Unsupported Media Type if it does not match; a
+// multipart request's own Content-Type is just its envelope, not a file's,
+// so it is left to the multipart handler to check each part instead. On
+// success the parsed claims are injected into the request context,
+// retrievable with TicketClaimsFromContext.
+//
+// This makes a two-step "prepare then upload" flow possible: a client first
+// hits an Authorize-protected endpoint to obtain a ticket, then presents it
+// on the actual upload request.
+func RequireTicket(signer *TicketSigner) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := r.Header.Get(TicketHeader)
+			if raw == "" {
+				response.Error(w, "missing upload ticket", http.StatusUnauthorized)
+				return
+			}
+			claims, err := signer.parse(raw)
+			if err != nil {
+				response.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			contentType := r.Header.Get("Content-Type")
+			if len(claims.AllowedMIMETypes) > 0 && !strings.HasPrefix(contentType, "multipart/form-data") &&
+				!mimeTypeAllowed(contentType, claims.AllowedMIMETypes) {
+				response.Error(w, fmt.Sprintf("upload: content type %q not allowed", contentType), http.StatusUnsupportedMediaType)
+				return
+			}
+			ctx := context.WithValue(r.Context(), ticketClaimsContextKey{}, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
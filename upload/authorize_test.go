@@ -0,0 +1,208 @@
+package upload_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/christowolf/server-playground/upload"
+)
+
+// TestAuthorizeIssuesTicket checks that a successful PreAuthorize call
+// results in a ticket being set on the response header, injected into the
+// request context, and next being called.
+func TestAuthorizeIssuesTicket(t *testing.T) {
+	t.Parallel()
+	signer := upload.NewHS256TicketSigner([]byte("test-secret"), time.Minute)
+	preauth := upload.PreAuthorizerFunc(func(_ context.Context, _ *http.Request) (upload.Authorization, error) {
+		return upload.Authorization{Key: "uploads/report.txt", MaxSize: 1024}, nil
+	})
+	var gotTicket string
+	var calledNext bool
+	sut := upload.Authorize(preauth, signer)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		calledNext = true
+		gotTicket, _ = upload.TicketFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+
+	if !calledNext {
+		t.Fatal("expected next handler to be called")
+	}
+	if gotTicket == "" {
+		t.Fatal("expected a ticket to be injected into the request context")
+	}
+	if w.Header().Get(upload.TicketHeader) != gotTicket {
+		t.Errorf("expected response header ticket to match context ticket")
+	}
+}
+
+// TestAuthorizeRejectsDeniedPreAuthorization checks that a PreAuthorizer
+// error stops the request before next is called.
+func TestAuthorizeRejectsDeniedPreAuthorization(t *testing.T) {
+	t.Parallel()
+	signer := upload.NewHS256TicketSigner([]byte("test-secret"), time.Minute)
+	preauth := upload.PreAuthorizerFunc(func(_ context.Context, _ *http.Request) (upload.Authorization, error) {
+		return upload.Authorization{}, errors.New("not allowed")
+	})
+	called := false
+	sut := upload.Authorize(preauth, signer)(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		called = true
+	}))
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+
+	if called {
+		t.Error("expected next handler not to be called")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status code: %v, got: %v", http.StatusForbidden, w.Code)
+	}
+}
+
+// TestRequireTicketAllowedMIMETypes checks that RequireTicket enforces a
+// ticket's AllowedMIMETypes against a non-multipart request's declared
+// Content-Type, but leaves a multipart request alone since its own
+// Content-Type is just its envelope.
+func TestRequireTicketAllowedMIMETypes(t *testing.T) {
+	t.Parallel()
+	signer := upload.NewHS256TicketSigner([]byte("test-secret"), time.Minute)
+	preauth := upload.PreAuthorizerFunc(func(_ context.Context, _ *http.Request) (upload.Authorization, error) {
+		return upload.Authorization{Key: "uploads/photo.png", AllowedMIMETypes: []string{"image/*"}}, nil
+	})
+	var issuedTicket string
+	issue := upload.Authorize(preauth, signer)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		issuedTicket, _ = upload.TicketFromContext(r.Context())
+	}))
+	issueReq := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload/prepare", nil)
+	issue.ServeHTTP(httptest.NewRecorder(), issueReq)
+	if issuedTicket == "" {
+		t.Fatal("expected a ticket to be issued")
+	}
+
+	var calledNext bool
+	verify := upload.RequireTicket(signer)(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		calledNext = true
+	}))
+
+	t.Run("disallowed content type rejected", func(t *testing.T) {
+		calledNext = false
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		r.Header.Set(upload.TicketHeader, issuedTicket)
+		r.Header.Set("Content-Type", "application/pdf")
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if calledNext {
+			t.Error("expected next handler not to be called")
+		}
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("expected status code: %v, got: %v", http.StatusUnsupportedMediaType, w.Code)
+		}
+	})
+
+	t.Run("allowed content type accepted", func(t *testing.T) {
+		calledNext = false
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		r.Header.Set(upload.TicketHeader, issuedTicket)
+		r.Header.Set("Content-Type", "image/png")
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if !calledNext {
+			t.Fatal("expected next handler to be called")
+		}
+	})
+
+	t.Run("multipart request left to the part-level check", func(t *testing.T) {
+		calledNext = false
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		r.Header.Set(upload.TicketHeader, issuedTicket)
+		r.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if !calledNext {
+			t.Fatal("expected next handler to be called")
+		}
+	})
+}
+
+// TestRequireTicketRoundTrip checks that a ticket issued by Authorize is
+// accepted by RequireTicket, and that a missing or invalid ticket is
+// rejected.
+func TestRequireTicketRoundTrip(t *testing.T) {
+	t.Parallel()
+	signer := upload.NewHS256TicketSigner([]byte("test-secret"), time.Minute)
+	preauth := upload.PreAuthorizerFunc(func(_ context.Context, _ *http.Request) (upload.Authorization, error) {
+		return upload.Authorization{Key: "uploads/report.txt"}, nil
+	})
+
+	var issuedTicket string
+	issue := upload.Authorize(preauth, signer)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		issuedTicket, _ = upload.TicketFromContext(r.Context())
+	}))
+	issueReq := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload/prepare", nil)
+	issue.ServeHTTP(httptest.NewRecorder(), issueReq)
+	if issuedTicket == "" {
+		t.Fatal("expected a ticket to be issued")
+	}
+
+	var claimsKey string
+	var calledNext bool
+	verify := upload.RequireTicket(signer)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		calledNext = true
+		if claims, ok := upload.TicketClaimsFromContext(r.Context()); ok {
+			claimsKey = claims.Key
+		}
+	}))
+
+	t.Run("valid ticket", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		r.Header.Set(upload.TicketHeader, issuedTicket)
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if !calledNext {
+			t.Fatal("expected next handler to be called")
+		}
+		if claimsKey != "uploads/report.txt" {
+			t.Errorf("expected claims key: %v, got: %v", "uploads/report.txt", claimsKey)
+		}
+	})
+
+	t.Run("missing ticket", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code: %v, got: %v", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("invalid ticket", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		r.Header.Set(upload.TicketHeader, issuedTicket+"-tampered")
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code: %v, got: %v", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("ticket signed with a different secret", func(t *testing.T) {
+		other := upload.NewHS256TicketSigner([]byte("other-secret"), time.Minute)
+		otherIssue := upload.Authorize(preauth, other)(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+		otherReq := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload/prepare", nil)
+		otherRec := httptest.NewRecorder()
+		otherIssue.ServeHTTP(otherRec, otherReq)
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com/upload", nil)
+		r.Header.Set(upload.TicketHeader, otherRec.Header().Get(upload.TicketHeader))
+		w := httptest.NewRecorder()
+		verify.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code: %v, got: %v", http.StatusUnauthorized, w.Code)
+		}
+	})
+}
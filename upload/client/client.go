@@ -0,0 +1,227 @@
+// Package client provides a Go client for the upload REST API, letting
+// programs push one or many files to the server in a single streaming
+// multipart request, without buffering the request body in memory.
+//
+// It follows the pattern of golang.org/x/perf/storage.Client's Upload and
+// CreateFile API:
+//
+//	c := client.New(baseURL)
+//	u := c.NewUpload(ctx)
+//	w, err := u.CreateFile("report.txt")
+//	io.Copy(w, src)
+//	status, err := u.Commit()
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"github.com/christowolf/server-playground/response"
+)
+
+// formName is the multipart form field name the upload API expects a file
+// under. It must match upload.formName, which is unexported.
+const formName = "file"
+
+// Client talks to the upload REST API at a base URL, e.g.
+// "http://localhost:8080"+upload.ApiUrl.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	authToken  string
+	progress   func(written int64)
+}
+
+// Option configures a Client created by New.
+type Option func(*Client)
+
+// WithHTTPClient overrides the *http.Client used for requests. Defaults to
+// http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAuthToken sets a bearer token sent as the Authorization header of
+// every request.
+func WithAuthToken(token string) Option {
+	return func(c *Client) { c.authToken = token }
+}
+
+// WithProgress sets a callback invoked as an Upload's files are written,
+// with the cumulative number of file content bytes written so far. Multipart
+// headers and boundaries are not counted.
+func WithProgress(f func(written int64)) Option {
+	return func(c *Client) { c.progress = f }
+}
+
+// New returns a Client that talks to the upload API at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: baseURL, httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// UploadStatus summarizes the server's response to an Upload.Commit.
+type UploadStatus struct {
+	// StatusCode is the HTTP status code the server responded with.
+	StatusCode int
+	// Files describes each file the server stored, parsed from the
+	// response's response.JsonDto, in the order they were added via
+	// CreateFile.
+	Files []*response.FileDto
+	// IDs are the keys Files were stored under, in the same order.
+	IDs []string
+}
+
+// uploadResult is sent once, on the Upload's result channel, once the
+// underlying HTTP round trip has completed.
+type uploadResult struct {
+	status *UploadStatus
+	err    error
+}
+
+// Upload is a single streaming multipart upload in progress, created by
+// Client.NewUpload. Call CreateFile for each file to include, write its
+// contents to the returned io.Writer, then call Commit to finish the
+// request and read back the server's response. mime/multipart.Writer
+// requires its parts to be written in order, so finish writing one file
+// fully before calling CreateFile again.
+type Upload struct {
+	client  *Client
+	pw      *io.PipeWriter
+	mw      *multipart.Writer
+	written int64
+	result  chan uploadResult
+}
+
+// NewUpload starts a new Upload against c: it spins up the streaming
+// multipart request in a background goroutine, connected to the returned
+// Upload via an io.Pipe, so nothing is buffered in memory.
+func (c *Client) NewUpload(ctx context.Context) *Upload {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	u := &Upload{client: c, pw: pw, mw: mw, result: make(chan uploadResult, 1)}
+	go u.do(ctx, pr)
+	return u
+}
+
+// do performs the HTTP round trip reading the multipart body from pr, and
+// reports its outcome on u.result.
+func (u *Upload) do(ctx context.Context, pr *io.PipeReader) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.client.baseURL, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		u.result <- uploadResult{err: fmt.Errorf("client: building request: %w", err)}
+		return
+	}
+	req.Header.Set("Content-Type", u.mw.FormDataContentType())
+	if u.client.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+u.client.authToken)
+	}
+	resp, err := u.client.httpClient.Do(req)
+	if err != nil {
+		u.result <- uploadResult{err: fmt.Errorf("client: uploading: %w", err)}
+		return
+	}
+	defer resp.Body.Close()
+	status, err := parseResponse(resp)
+	u.result <- uploadResult{status: status, err: err}
+}
+
+// FileOption configures a single file added via Upload.CreateFile.
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	mimeType string
+}
+
+// WithMimeType overrides the Content-Type the multipart part for this file
+// declares, which is otherwise application/octet-stream.
+func WithMimeType(mimeType string) FileOption {
+	return func(o *fileOptions) { o.mimeType = mimeType }
+}
+
+// CreateFile adds a new file part named name to the upload and returns a
+// writer for its contents. It may be called more than once per Upload to
+// add several files to a single request.
+func (u *Upload) CreateFile(name string, opts ...FileOption) (io.Writer, error) {
+	o := &fileOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var part io.Writer
+	var err error
+	if o.mimeType != "" {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, formName, name))
+		h.Set("Content-Type", o.mimeType)
+		part, err = u.mw.CreatePart(h)
+	} else {
+		part, err = u.mw.CreateFormFile(formName, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("client: creating file part %q: %w", name, err)
+	}
+	return &progressWriter{w: part, upload: u}, nil
+}
+
+// progressWriter wraps a multipart part writer to report the upload's
+// cumulative bytes written to its Client's Progress callback, if any.
+type progressWriter struct {
+	w      io.Writer
+	upload *Upload
+}
+
+// Write implements io.Writer.
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.upload.written += int64(n)
+	if f := pw.upload.client.progress; f != nil {
+		f(pw.upload.written)
+	}
+	return n, err
+}
+
+// Commit finishes the multipart request, waits for the server's response,
+// and returns it as an UploadStatus.
+func (u *Upload) Commit() (*UploadStatus, error) {
+	closeErr := u.mw.Close()
+	u.pw.CloseWithError(closeErr) // CloseWithError(nil) behaves like a plain Close.
+	result := <-u.result
+	if result.err != nil {
+		return nil, result.err
+	}
+	if closeErr != nil {
+		return nil, fmt.Errorf("client: closing multipart writer: %w", closeErr)
+	}
+	return result.status, nil
+}
+
+// parseResponse decodes resp's body as a response.JsonDto and translates it
+// into an UploadStatus.
+func parseResponse(resp *http.Response) (*UploadStatus, error) {
+	var dto response.JsonDto
+	if err := json.NewDecoder(resp.Body).Decode(&dto); err != nil {
+		return nil, fmt.Errorf("client: decoding response: %w", err)
+	}
+	status := &UploadStatus{StatusCode: resp.StatusCode}
+	for _, f := range dto.Files {
+		status.Files = append(status.Files, f)
+		status.IDs = append(status.IDs, f.Name)
+	}
+	if len(status.Files) == 0 && dto.File != nil {
+		status.Files = append(status.Files, dto.File)
+		status.IDs = append(status.IDs, dto.File.Name)
+	}
+	if dto.ErrorString != "" {
+		return status, fmt.Errorf("client: server returned status %v: %v", dto.Status, dto.ErrorString)
+	}
+	return status, nil
+}
@@ -0,0 +1,245 @@
+// Package client_test provides a test suite for the client package.
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christowolf/server-playground/upload"
+	"github.com/christowolf/server-playground/upload/client"
+	"github.com/christowolf/server-playground/upload/localfs"
+)
+
+// TestUploadCommitSuccess tests a full round trip against a real upload API
+// handler: the file written via CreateFile arrives intact, and Commit
+// reports it back in the UploadStatus.
+func TestUploadCommitSuccess(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, err := localfs.New(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	srv := httptest.NewServer(upload.NewHandler(store))
+	defer srv.Close()
+
+	c := client.New(srv.URL + upload.ApiUrl)
+	u := c.NewUpload(context.Background())
+	content := "report content"
+	w, err := u.CreateFile("report.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := io.Copy(w, strings.NewReader(content)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	status, err := u.Commit()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if status.StatusCode != http.StatusCreated {
+		t.Errorf("expected status code: %v, got: %v", http.StatusCreated, status.StatusCode)
+	}
+	if len(status.Files) != 1 || len(status.IDs) != 1 {
+		t.Fatalf("expected a single file and ID, got: %v", status)
+	}
+	if status.Files[0].Name != status.IDs[0] {
+		t.Errorf("expected the file name to match its ID, got: %v, %v", status.Files[0].Name, status.IDs[0])
+	}
+	gotContent, err := os.ReadFile(filepath.Join(dir, status.IDs[0]))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if string(gotContent) != content {
+		t.Errorf("expected content: %v, got: %v", content, string(gotContent))
+	}
+}
+
+// TestUploadCommitServerError tests that Commit surfaces a server-side
+// error response rather than reporting success.
+func TestUploadCommitServerError(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":500,"message":"Internal Server Error","error":"storage unavailable"}`))
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	u := c.NewUpload(context.Background())
+	w, err := u.CreateFile("report.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := io.Copy(w, strings.NewReader("content")); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := u.Commit(); err == nil {
+		t.Error("expected Commit to report the server's error")
+	}
+}
+
+// erroringTransport simulates a connection that breaks mid-stream: it reads
+// a few bytes of the request body, closes it, and returns a transport-level
+// error, without ever producing an *http.Response.
+type erroringTransport struct {
+	readBytes int
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *erroringTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	io.ReadFull(req.Body, make([]byte, t.readBytes))
+	req.Body.Close()
+	return nil, errors.New("simulated connection reset")
+}
+
+// TestUploadMidStreamError tests that a transport failure mid-upload closes
+// the pipe cleanly -- CreateFile's writer errors out instead of blocking
+// forever, and Commit reports the underlying error.
+func TestUploadMidStreamError(t *testing.T) {
+	t.Parallel()
+	hc := &http.Client{Transport: &erroringTransport{readBytes: 8}}
+	c := client.New("http://example.invalid/api/upload/", client.WithHTTPClient(hc))
+	u := c.NewUpload(context.Background())
+	w, err := u.CreateFile("report.txt")
+	if err == nil {
+		// The part header made it through before the transport closed the
+		// pipe; the write that follows should surface the broken connection.
+		_, err = io.Copy(w, strings.NewReader(strings.Repeat("x", 1<<20)))
+	}
+	if err == nil {
+		t.Error("expected an error once the transport closed the request body")
+	}
+	if _, err := u.Commit(); err == nil {
+		t.Error("expected Commit to report the transport's error")
+	}
+}
+
+// TestUploadCreateFileMultiple tests a full round trip of a single Upload
+// with several files added via repeated CreateFile calls: the server stores
+// all of them, and Commit reports every one back in the UploadStatus.
+func TestUploadCreateFileMultiple(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, err := localfs.New(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	srv := httptest.NewServer(upload.NewHandler(store))
+	defer srv.Close()
+
+	c := client.New(srv.URL + upload.ApiUrl)
+	u := c.NewUpload(context.Background())
+	contents := map[string]string{"first.txt": "first content", "second.txt": "second content"}
+	for _, name := range []string{"first.txt", "second.txt"} {
+		w, err := u.CreateFile(name)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, err := io.Copy(w, strings.NewReader(contents[name])); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	status, err := u.Commit()
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(status.Files) != 2 || len(status.IDs) != 2 {
+		t.Fatalf("expected two files and IDs, got: %v", status)
+	}
+	for i, id := range status.IDs {
+		gotContent, err := os.ReadFile(filepath.Join(dir, id))
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if want := contents[status.Files[i].Name]; string(gotContent) != want {
+			t.Errorf("expected content: %v, got: %v", want, string(gotContent))
+		}
+	}
+}
+
+// TestUploadWithMimeType tests that WithMimeType overrides the part's
+// declared Content-Type, as seen by the receiving server.
+func TestUploadWithMimeType(t *testing.T) {
+	t.Parallel()
+	var gotContentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		}
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("expected no error, got: %v", err)
+		} else {
+			gotContentType = header.Header.Get("Content-Type")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":201,"message":"Created"}`))
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	u := c.NewUpload(context.Background())
+	w, err := u.CreateFile("data.bin", client.WithMimeType("application/octet-stream"))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	io.Copy(w, strings.NewReader("binary content"))
+	if _, err := u.Commit(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if gotContentType != "application/octet-stream" {
+		t.Errorf("expected content type: %v, got: %v", "application/octet-stream", gotContentType)
+	}
+}
+
+// TestUploadProgress tests that WithProgress reports monotonically
+// increasing cumulative byte counts as a file is written.
+func TestUploadProgress(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":201,"message":"Created"}`))
+	}))
+	defer srv.Close()
+
+	var progressed []int64
+	c := client.New(srv.URL, client.WithProgress(func(written int64) {
+		progressed = append(progressed, written)
+	}))
+	u := c.NewUpload(context.Background())
+	w, err := u.CreateFile("report.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	content := strings.Repeat("x", 256)
+	if _, err := io.Copy(w, strings.NewReader(content)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := u.Commit(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(progressed) == 0 {
+		t.Fatal("expected at least one progress callback")
+	}
+	if last := progressed[len(progressed)-1]; last != int64(len(content)) {
+		t.Errorf("expected final progress: %v, got: %v", len(content), last)
+	}
+	for i := 1; i < len(progressed); i++ {
+		if progressed[i] < progressed[i-1] {
+			t.Errorf("expected monotonically increasing progress, got: %v", progressed)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package upload
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+// RenamePolicy decides the storage key a validated upload is given, based on
+// its (already sanitized, if Config.SanitizeFilename is set) original name
+// and its sniffed MIME type. Keep, UUID, and Slug cover the common cases;
+// assign any other func value for a custom naming scheme.
+type RenamePolicy func(originalName, detectedMIME string) string
+
+// Keep stores an upload under its original name, unchanged. It is the
+// default RenamePolicy.
+var Keep RenamePolicy = func(originalName, _ string) string { return originalName }
+
+// UUID stores an upload under a randomly generated name, preserving the
+// original file extension.
+var UUID RenamePolicy = func(originalName, _ string) string {
+	return uuid.NewString() + filepath.Ext(originalName)
+}
+
+// Slug stores an upload under a lowercased, hyphen-separated slug of its
+// original name, preserving the file extension.
+var Slug RenamePolicy = func(originalName, _ string) string {
+	ext := filepath.Ext(originalName)
+	return slugify(strings.TrimSuffix(originalName, ext)) + ext
+}
+
+// slugify lowercases s and collapses every run of characters that are
+// neither letters nor digits into a single hyphen, trimming a leading or
+// trailing one.
+func slugify(s string) string {
+	var b strings.Builder
+	lastHyphen := true // Avoid a leading hyphen.
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			lastHyphen = false
+			continue
+		}
+		if !lastHyphen {
+			b.WriteByte('-')
+			lastHyphen = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// unsafeFilenameChars are replaced with "-" by sanitizeFilename: path
+// separators and characters that are either meaningless or troublesome in a
+// storage key, a file system path, or a Content-Disposition header.
+const unsafeFilenameChars = `/\:*?"<>|`
+
+// sanitizeFilename returns name made safe for use as a storage key: reduced
+// to its final path component (which discards any directory part, including
+// "../" segments attempting to escape it), Unicode-normalized to NFC so that
+// visually identical names compare equal, and with unsafeFilenameChars and
+// control characters replaced by "-".
+func sanitizeFilename(name string) string {
+	name = filepath.Base(filepath.Clean("/" + name))
+	name = norm.NFC.String(name)
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsControl(r) || strings.ContainsRune(unsafeFilenameChars, r) {
+			b.WriteByte('-')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	if sanitized := b.String(); sanitized != "" && sanitized != "." {
+		return sanitized
+	}
+	return "upload"
+}
@@ -0,0 +1,209 @@
+// Package localfs implements upload.Storage backed by the local filesystem,
+// the original storage behavior of this module before it grew a pluggable
+// Storage interface.
+package localfs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/christowolf/server-playground/upload"
+)
+
+// metaSuffix is the extension of the JSON sidecar file localfs persists
+// alongside each object, to carry metadata the filesystem itself does not
+// track, such as MIME type and content hash.
+const metaSuffix = ".localfs.meta.json"
+
+// sidecarMeta is the JSON schema of a localfs metadata sidecar file.
+type sidecarMeta struct {
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+}
+
+// Storage stores objects as files under a root directory, creating it on
+// first use if it does not exist yet.
+type Storage struct {
+	root string
+}
+
+// New returns a Storage rooted at dir, creating dir if it does not exist.
+func New(dir string) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("localfs: creating root directory: %w", err)
+	}
+	return &Storage{root: dir}, nil
+}
+
+// Put stores the content read from r under key and returns the resulting
+// upload.StoredObject. It has no URL of its own, since the file is only
+// reachable through this process.
+func (s *Storage) Put(_ context.Context, key string, r io.Reader, meta upload.ObjectMeta) (upload.StoredObject, error) {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return upload.StoredObject{}, fmt.Errorf("localfs: creating directory for %q: %w", key, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return upload.StoredObject{}, fmt.Errorf("localfs: creating %q: %w", key, err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), r)
+	if err != nil {
+		return upload.StoredObject{}, fmt.Errorf("localfs: writing %q: %w", key, err)
+	}
+	meta.Size = size
+	meta.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	if err := writeSidecar(path, meta); err != nil {
+		return upload.StoredObject{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return upload.StoredObject{}, fmt.Errorf("localfs: statting %q: %w", key, err)
+	}
+	meta.ModTime = info.ModTime()
+	return upload.StoredObject{Key: key, ObjectMeta: meta}, nil
+}
+
+// Open returns a reader for the object stored under key, along with its
+// metadata. The returned reader is an *os.File, which also implements
+// io.Seeker, so callers may serve Range requests against it.
+func (s *Storage) Open(_ context.Context, key string) (io.ReadCloser, upload.ObjectMeta, error) {
+	path := s.path(key)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, upload.ObjectMeta{}, fmt.Errorf("localfs: opening %q: %w", key, err)
+	}
+	meta, err := stat(path, f)
+	if err != nil {
+		f.Close()
+		return nil, upload.ObjectMeta{}, err
+	}
+	return f, meta, nil
+}
+
+// Delete removes the object stored under key, along with its metadata
+// sidecar.
+func (s *Storage) Delete(_ context.Context, key string) error {
+	path := s.path(key)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("localfs: removing %q: %w", key, err)
+	}
+	if err := os.Remove(path + metaSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("localfs: removing metadata for %q: %w", key, err)
+	}
+	return nil
+}
+
+// Stat returns metadata for the object stored under key without opening it.
+func (s *Storage) Stat(_ context.Context, key string) (upload.ObjectMeta, error) {
+	return stat(s.path(key), nil)
+}
+
+// List returns the objects stored directly under prefix, along with any
+// pseudo-directories found under it, derived from "/" separators in keys.
+func (s *Storage) List(_ context.Context, prefix string) (upload.ListResult, error) {
+	result := upload.ListResult{}
+	commonPrefixes := map[string]bool{}
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, metaSuffix) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		remainder := key[len(prefix):]
+		if slash := strings.Index(remainder, "/"); slash >= 0 {
+			commonPrefixes[key[:len(prefix)+slash+1]] = true
+			return nil
+		}
+		meta, err := stat(path, nil)
+		if err != nil {
+			return err
+		}
+		result.Entries = append(result.Entries, upload.ObjectInfo{Key: key, ObjectMeta: meta})
+		return nil
+	})
+	if err != nil {
+		return upload.ListResult{}, fmt.Errorf("localfs: listing %q: %w", prefix, err)
+	}
+	for p := range commonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, p)
+	}
+	sort.Strings(result.CommonPrefixes)
+	sort.Slice(result.Entries, func(i, j int) bool { return result.Entries[i].Key < result.Entries[j].Key })
+	return result, nil
+}
+
+// path resolves key to a path under the storage root. A key that would
+// escape the root via ".." segments is confined back under it, not rejected.
+func (s *Storage) path(key string) string {
+	return filepath.Join(s.root, filepath.Clean(string(filepath.Separator)+key))
+}
+
+// stat returns metadata for path, reading its sidecar if present and falling
+// back to f (or a fresh os.Stat of path) for size and modification time.
+func stat(path string, f *os.File) (upload.ObjectMeta, error) {
+	var info os.FileInfo
+	var err error
+	if f != nil {
+		info, err = f.Stat()
+	} else {
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return upload.ObjectMeta{}, fmt.Errorf("localfs: statting %q: %w", path, err)
+	}
+	meta := upload.ObjectMeta{Size: info.Size(), ModTime: info.ModTime()}
+	if sidecar, err := readSidecar(path); err == nil {
+		meta.MimeType = sidecar.MimeType
+		meta.SHA256 = sidecar.SHA256
+	}
+	return meta, nil
+}
+
+// writeSidecar persists meta's MIME type and content hash alongside path.
+func writeSidecar(path string, meta upload.ObjectMeta) error {
+	data, err := json.Marshal(sidecarMeta{MimeType: meta.MimeType, SHA256: meta.SHA256})
+	if err != nil {
+		return fmt.Errorf("localfs: marshaling metadata for %q: %w", path, err)
+	}
+	if err := os.WriteFile(path+metaSuffix, data, 0666); err != nil {
+		return fmt.Errorf("localfs: writing metadata for %q: %w", path, err)
+	}
+	return nil
+}
+
+// readSidecar reads the metadata sidecar for path, if any.
+func readSidecar(path string) (sidecarMeta, error) {
+	data, err := os.ReadFile(path + metaSuffix)
+	if err != nil {
+		return sidecarMeta{}, err
+	}
+	var meta sidecarMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return sidecarMeta{}, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,148 @@
+// Package localfs_test provides a test suite for the localfs package.
+package localfs_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/christowolf/server-playground/upload"
+	"github.com/christowolf/server-playground/upload/localfs"
+)
+
+// TestStoragePutOpenStatDelete exercises the full upload.Storage lifecycle
+// against a localfs.Storage rooted at a temporary directory.
+func TestStoragePutOpenStatDelete(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, err := localfs.New(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ctx := context.Background()
+	key := "nested/report.txt"
+	content := "report content"
+
+	stored, err := store.Put(ctx, key, strings.NewReader(content), upload.ObjectMeta{MimeType: "text/plain"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if stored.Key != key {
+		t.Errorf("expected key: %v, got: %v", key, stored.Key)
+	}
+	if stored.Size != int64(len(content)) {
+		t.Errorf("expected size: %v, got: %v", len(content), stored.Size)
+	}
+	if _, err := os.Stat(filepath.Join(dir, key)); err != nil {
+		t.Fatalf("expected file on disk, got error: %v", err)
+	}
+
+	wantSum := sha256.Sum256([]byte(content))
+	wantSHA256 := hex.EncodeToString(wantSum[:])
+	if stored.SHA256 != wantSHA256 {
+		t.Errorf("expected sha256: %v, got: %v", wantSHA256, stored.SHA256)
+	}
+
+	meta, err := store.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if meta.Size != int64(len(content)) {
+		t.Errorf("expected size: %v, got: %v", len(content), meta.Size)
+	}
+	if meta.MimeType != "text/plain" {
+		t.Errorf("expected mime type: %v, got: %v", "text/plain", meta.MimeType)
+	}
+	if meta.SHA256 != wantSHA256 {
+		t.Errorf("expected sha256: %v, got: %v", wantSHA256, meta.SHA256)
+	}
+
+	r, openMeta, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if string(got) != content {
+		t.Errorf("expected content: %v, got: %v", content, string(got))
+	}
+	if openMeta.SHA256 != wantSHA256 {
+		t.Errorf("expected sha256: %v, got: %v", wantSHA256, openMeta.SHA256)
+	}
+	if _, ok := r.(io.Seeker); !ok {
+		t.Error("expected the returned reader to also support seeking, for Range support")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, key)); !os.IsNotExist(err) {
+		t.Errorf("expected file to be removed, got error: %v", err)
+	}
+}
+
+// TestStoragePathEscape checks that a key trying to escape the storage root
+// via ".." is confined back under it instead of reaching outside.
+func TestStoragePathEscape(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	dir := filepath.Join(root, "store")
+	store, err := localfs.New(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := store.Put(ctx, "../escape.txt", strings.NewReader("x"), upload.ObjectMeta{}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no file outside the storage root, got error: %v", err)
+	}
+}
+
+// TestStorageList checks that List reports entries under a prefix and
+// groups deeper keys into common prefixes, mirroring pseudo-directories.
+func TestStorageList(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, err := localfs.New(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"reports/a.txt", "reports/b.txt", "reports/2024/c.txt", "readme.txt"} {
+		if _, err := store.Put(ctx, key, strings.NewReader(key), upload.ObjectMeta{}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+
+	result, err := store.List(ctx, "reports/")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	var gotEntries []string
+	for _, e := range result.Entries {
+		gotEntries = append(gotEntries, e.Key)
+	}
+	wantEntries := []string{"reports/a.txt", "reports/b.txt"}
+	if len(gotEntries) != len(wantEntries) {
+		t.Fatalf("expected entries: %v, got: %v", wantEntries, gotEntries)
+	}
+	for i, want := range wantEntries {
+		if gotEntries[i] != want {
+			t.Errorf("expected entry: %v, got: %v", want, gotEntries[i])
+		}
+	}
+	wantPrefixes := []string{"reports/2024/"}
+	if len(result.CommonPrefixes) != len(wantPrefixes) || result.CommonPrefixes[0] != wantPrefixes[0] {
+		t.Errorf("expected common prefixes: %v, got: %v", wantPrefixes, result.CommonPrefixes)
+	}
+}
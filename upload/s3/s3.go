@@ -0,0 +1,251 @@
+// Package s3 implements upload.Storage backed by an S3-compatible object
+// store, using multipart uploads for large payloads and pre-signed URLs for
+// direct downloads.
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/christowolf/server-playground/upload"
+)
+
+// defaultPresignExpiry is how long a pre-signed GET URL returned by Put
+// remains valid.
+const defaultPresignExpiry = 15 * time.Minute
+
+// sha256MetadataKey is the user metadata key Put stores an object's content
+// hash under, since S3's own ETag is not guaranteed to be a sha256 (it is an
+// MD5 for single-part uploads, and opaque for multipart ones).
+const sha256MetadataKey = "sha256"
+
+// Storage stores objects in a single S3-compatible bucket.
+type Storage struct {
+	client        *s3.Client
+	uploader      *manager.Uploader
+	presigner     *s3.PresignClient
+	bucket        string
+	presignExpiry time.Duration
+}
+
+// Option configures a Storage created by New.
+type Option func(*Storage)
+
+// WithPresignExpiry overrides how long pre-signed download URLs returned by
+// Put remain valid. Defaults to 15 minutes.
+func WithPresignExpiry(d time.Duration) Option {
+	return func(s *Storage) { s.presignExpiry = d }
+}
+
+// New returns a Storage that stores objects in bucket using client.
+func New(client *s3.Client, bucket string, opts ...Option) *Storage {
+	s := &Storage{
+		client:        client,
+		uploader:      manager.NewUploader(client),
+		presigner:     s3.NewPresignClient(client),
+		bucket:        bucket,
+		presignExpiry: defaultPresignExpiry,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Put stores the content read from r under key, using a multipart upload for
+// payloads larger than the manager's part size threshold, and returns the
+// resulting upload.StoredObject with a pre-signed download URL.
+//
+// If r also implements io.Seeker, Put hashes it up front and stores the
+// result as object metadata, so later Stat/Open/List calls can report a
+// content hash. Non-seekable readers are uploaded without one, to avoid
+// buffering the whole payload just to compute it.
+func (s *Storage) Put(ctx context.Context, key string, r io.Reader, meta upload.ObjectMeta) (upload.StoredObject, error) {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	}
+	if meta.MimeType != "" {
+		input.ContentType = aws.String(meta.MimeType)
+	}
+	if rs, ok := r.(io.ReadSeeker); ok {
+		sha256Hex, err := sha256Sum(rs)
+		if err != nil {
+			return upload.StoredObject{}, fmt.Errorf("s3: hashing %q: %w", key, err)
+		}
+		input.Metadata = map[string]string{sha256MetadataKey: sha256Hex}
+	}
+	if _, err := s.uploader.Upload(ctx, input); err != nil {
+		return upload.StoredObject{}, fmt.Errorf("s3: uploading %q: %w", key, err)
+	}
+	stored, err := s.Stat(ctx, key)
+	if err != nil {
+		return upload.StoredObject{}, err
+	}
+	url, err := s.presignGet(ctx, key)
+	if err != nil {
+		return upload.StoredObject{}, err
+	}
+	return upload.StoredObject{Key: key, ObjectMeta: stored, URL: url}, nil
+}
+
+// sha256Sum hashes rs in full, then rewinds it to the start.
+func sha256Sum(rs io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Open returns a reader for the object stored under key, along with its
+// metadata.
+func (s *Storage) Open(ctx context.Context, key string) (io.ReadCloser, upload.ObjectMeta, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, upload.ObjectMeta{}, fmt.Errorf("s3: getting %q: %w", key, err)
+	}
+	meta := upload.ObjectMeta{
+		Size:    aws.ToInt64(out.ContentLength),
+		ModTime: aws.ToTime(out.LastModified),
+		SHA256:  metadataValue(out.Metadata, sha256MetadataKey),
+	}
+	if out.ContentType != nil {
+		meta.MimeType = *out.ContentType
+	}
+	return out.Body, meta, nil
+}
+
+// OpenRange returns a reader for length bytes of the object stored under
+// key, starting at offset, via a ranged GET request. It implements
+// upload.RangeOpener, letting callers that need random access to a large
+// object (e.g. to parse a zip's central directory) avoid downloading it in
+// full, since Open's reader does not support io.ReaderAt.
+func (s *Storage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3: getting range of %q: %w", key, err)
+	}
+	return out.Body, nil
+}
+
+// Delete removes the object stored under key.
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("s3: deleting %q: %w", key, err)
+	}
+	return nil
+}
+
+// Stat returns metadata for the object stored under key without downloading
+// it, via a HEAD request.
+func (s *Storage) Stat(ctx context.Context, key string) (upload.ObjectMeta, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return upload.ObjectMeta{}, fmt.Errorf("s3: statting %q: %w", key, err)
+	}
+	meta := upload.ObjectMeta{
+		Size:    aws.ToInt64(out.ContentLength),
+		ModTime: aws.ToTime(out.LastModified),
+		SHA256:  metadataValue(out.Metadata, sha256MetadataKey),
+	}
+	if out.ContentType != nil {
+		meta.MimeType = *out.ContentType
+	}
+	return meta, nil
+}
+
+// List returns the objects stored directly under prefix, along with any
+// pseudo-directories found under it, using a "/" delimiter. Entries' SHA256
+// is left empty: ListObjectsV2 does not return user metadata, so callers
+// needing it should Stat the entry directly.
+func (s *Storage) List(ctx context.Context, prefix string) (upload.ListResult, error) {
+	result := upload.ListResult{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return upload.ListResult{}, fmt.Errorf("s3: listing %q: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			result.Entries = append(result.Entries, upload.ObjectInfo{
+				Key: aws.ToString(obj.Key),
+				ObjectMeta: upload.ObjectMeta{
+					Size:    aws.ToInt64(obj.Size),
+					ModTime: aws.ToTime(obj.LastModified),
+				},
+			})
+		}
+		for _, cp := range page.CommonPrefixes {
+			result.CommonPrefixes = append(result.CommonPrefixes, aws.ToString(cp.Prefix))
+		}
+	}
+	return result, nil
+}
+
+// presignGet returns a pre-signed GET URL for key, valid for presignExpiry.
+func (s *Storage) presignGet(ctx context.Context, key string) (string, error) {
+	req, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(s.presignExpiry))
+	if err != nil {
+		return "", fmt.Errorf("s3: pre-signing %q: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// PresignPut returns a pre-signed PUT URL for key, valid for presignExpiry,
+// that a client can upload directly to without routing the body through
+// this process at all, mirroring the download URLs Put itself returns.
+func (s *Storage) PresignPut(ctx context.Context, key string) (string, error) {
+	req, err := s.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(s.presignExpiry))
+	if err != nil {
+		return "", fmt.Errorf("s3: pre-signing put for %q: %w", key, err)
+	}
+	return req.URL, nil
+}
+
+// metadataValue looks up key in metadata case-insensitively, since S3
+// normalizes user metadata key casing in ways that vary by SDK and endpoint.
+func metadataValue(metadata map[string]string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
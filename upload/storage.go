@@ -0,0 +1,81 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectMeta carries metadata about a stored object, independent of the
+// backend that persisted it.
+type ObjectMeta struct {
+	// MimeType is the object's media type, e.g. "image/png".
+	MimeType string
+	// Size is the object's size in bytes.
+	Size int64
+	// SHA256 is the object's content hash, hex encoded. It is empty if the
+	// backend did not compute or persist one.
+	SHA256 string
+	// ModTime is when the object was last stored.
+	ModTime time.Time
+}
+
+// StoredObject describes an object after a Storage backend has persisted it.
+type StoredObject struct {
+	// Key is the key the object was stored under.
+	Key string
+	ObjectMeta
+	// URL is a location the object can be retrieved from directly, such as a
+	// pre-signed download URL. It is empty if the backend has none to offer.
+	URL string
+}
+
+// ObjectInfo describes one object returned by Storage.List.
+type ObjectInfo struct {
+	// Key is the object's full key.
+	Key string
+	ObjectMeta
+}
+
+// ListResult is returned by Storage.List.
+type ListResult struct {
+	// Entries are the objects found directly under the listed prefix.
+	Entries []ObjectInfo
+	// CommonPrefixes are pseudo-directories found under the listed prefix,
+	// derived from "/" separators in keys.
+	CommonPrefixes []string
+}
+
+// Storage persists and retrieves uploaded files. Implementations may back
+// onto the local filesystem, an S3-compatible object store, or anything else
+// that can store a stream of bytes under a key. See the localfs and s3
+// subpackages for the implementations shipped with this module.
+type Storage interface {
+	// Put stores the content read from r under key and returns the
+	// resulting StoredObject.
+	Put(ctx context.Context, key string, r io.Reader, meta ObjectMeta) (StoredObject, error)
+	// Open returns a reader for the object stored under key, along with its
+	// metadata. The caller is responsible for closing the reader. If the
+	// returned reader also implements io.Seeker, callers may serve Range
+	// requests against it.
+	Open(ctx context.Context, key string) (io.ReadCloser, ObjectMeta, error)
+	// Delete removes the object stored under key.
+	Delete(ctx context.Context, key string) error
+	// Stat returns metadata for the object stored under key without opening it.
+	Stat(ctx context.Context, key string) (ObjectMeta, error)
+	// List returns the objects stored directly under prefix, along with any
+	// pseudo-directories found under it.
+	List(ctx context.Context, prefix string) (ListResult, error)
+}
+
+// RangeOpener is optionally implemented by Storage backends that can serve a
+// specific byte range of an object without reading the whole thing, such as
+// S3's ranged GET requests. Callers that need random access to a large
+// object (e.g. to inspect a zip's central directory) should type-assert for
+// it before falling back to a backend's Open, whose reader may or may not
+// support io.ReaderAt.
+type RangeOpener interface {
+	// OpenRange returns a reader for length bytes of the object stored under
+	// key, starting at offset.
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
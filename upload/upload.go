@@ -3,16 +3,53 @@
 package upload
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/google/uuid"
+
+	"github.com/christowolf/server-playground/response"
+	"github.com/christowolf/server-playground/upload/archive"
 )
 
+// prefixParam is the query parameter GET requests without a key use to
+// select which prefix to list.
+const prefixParam = "prefix"
+
+// entryPathParam is the query parameter GET .../entry requests use to select
+// which archive entry to extract, base64url-encoded.
+const entryPathParam = "path"
+
+// entrySuffix is the path suffix, appended to an archive's own key, that
+// routes a GET request to archive entry extraction instead of a plain
+// download.
+const entrySuffix = "/entry"
+
+// zipMimeType is the media type storeOne checks a newly stored object's
+// sniffed MIME type against to decide whether to generate an archive
+// metadata sidecar for it.
+const zipMimeType = "application/zip"
+
+// sniffPrefixSize is the number of bytes sniffContentType buffers from an
+// upload's body to guess its MIME type, matching what http.DetectContentType
+// itself inspects.
+const sniffPrefixSize = 512
+
 const (
 	// Url is the URL of the upload service web UI.
 	Url = "/upload/"
@@ -21,20 +58,75 @@ const (
 	// staticDir is the directory containing static content
 	// associated to uploading, like index.html for the upload service web UI.
 	staticDir = "./upload/static/"
-	// uploadDir is the directory where uploaded files are stored.
-	uploadDir = "./files/"
+	// UploadDir is the default directory local storage backends store
+	// uploaded files under.
+	UploadDir = "./files/"
 	// formName is the name of the form field containing the file.
 	formName = "file"
 )
 
-// Api returns an http.Handler that serves the upload API.
-func ApiEndpoint() http.Handler {
+// Config bounds and normalizes what handleForm and handleOther accept
+// before handing it to Storage.
+type Config struct {
+	// AllowedMIMETypes restricts accepted uploads to these MIME types,
+	// checked against both the declared Content-Type and the type sniffed
+	// from the body, so a client cannot bypass it by lying in its header. An
+	// entry ending in "/*" matches any subtype, e.g. "image/*". No
+	// restriction, the default, allows every type.
+	AllowedMIMETypes []string
+	// MaxFileSize caps how many bytes a request body may contain. For a
+	// multipart request the cap covers the whole body, every file part and
+	// the multipart framing together. Zero, the default, means unlimited.
+	MaxFileSize int64
+	// RenamePolicy decides the key a validated upload is stored under. A nil
+	// RenamePolicy, the default, is equivalent to Keep.
+	RenamePolicy RenamePolicy
+	// SanitizeFilename runs a file's name through sanitizeFilename before
+	// RenamePolicy sees it, stripping directory components, ".." segments,
+	// and characters unsafe for a storage key. Defaults to enabled; a
+	// Config built with WithConfig must set it explicitly to keep that
+	// default, since Config{} otherwise leaves it off.
+	SanitizeFilename bool
+}
+
+// DefaultConfig is the Config NewHandler applies when WithConfig is not
+// given: no MIME allowlist or size cap, RenamePolicy Keep, and filename
+// sanitization enabled.
+func DefaultConfig() Config {
+	return Config{RenamePolicy: Keep, SanitizeFilename: true}
+}
+
+// Handler serves the upload REST API, persisting uploaded files to a Storage
+// backend.
+type Handler struct {
+	store  Storage
+	config Config
+}
+
+// HandlerOption configures a Handler created by NewHandler.
+type HandlerOption func(*Handler)
+
+// WithConfig overrides the Config a Handler validates uploads against.
+// Defaults to DefaultConfig.
+func WithConfig(cfg Config) HandlerOption {
+	return func(h *Handler) { h.config = cfg }
+}
+
+// NewHandler returns an http.Handler that serves the upload API, persisting
+// uploaded files to store.
+func NewHandler(store Storage, opts ...HandlerOption) http.Handler {
+	h := &Handler{store: store, config: DefaultConfig()}
+	for _, opt := range opts {
+		opt(h)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
-		// case "GET":
-		// 	http.ServeFile(w, r, staticDir + "index.html")
 		case http.MethodPost:
-			handlePost(w, r)
+			h.handlePost(w, r)
+		case http.MethodGet:
+			h.handleGet(w, r)
+		case http.MethodHead:
+			h.handleHead(w, r)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
@@ -42,46 +134,85 @@ func ApiEndpoint() http.Handler {
 }
 
 // POST request wrapper function.
-func handlePost(w http.ResponseWriter, r *http.Request) {
-	if err := handleForm(w, r); err == nil ||
+func (h *Handler) handlePost(w http.ResponseWriter, r *http.Request) {
+	if h.config.MaxFileSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFileSize)
+	}
+	if err := h.handleForm(w, r); err == nil ||
 		(err != nil && !errors.Is(err, http.ErrNotMultipart)) {
 		return // Either the form was handled correctly or the error was already written to the response.
 	}
-	if err := handleOther(w, r); err != nil && errors.Is(err, http.ErrNotSupported) {
-		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	if err := h.handleOther(w, r); err != nil && errors.Is(err, http.ErrNotSupported) {
+		response.Error(w, err.Error(), http.StatusUnsupportedMediaType)
 	}
 	// Otherwise, the error was already written to the response.
 }
 
 // Handles POST requests of form-data media to the API.
-func handleForm(w http.ResponseWriter, r *http.Request) error {
+func (h *Handler) handleForm(w http.ResponseWriter, r *http.Request) error {
 	// Check if the media type is multipart/form-data.
-	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
 		return http.ErrNotMultipart
 	}
-	// Parse the form.
-	err := r.ParseMultipartForm(32 << 20)
+	// Walk the multipart body part by part instead of calling
+	// r.ParseMultipartForm, so each file's bytes are streamed straight into
+	// validateUpload/storeOne rather than buffered into memory (or a temp
+	// file) in full first. Every part named formName is stored, not just the
+	// first, so a single request may upload more than one file.
+	_, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		response.Error(w, err.Error(), http.StatusBadRequest)
 		return err
 	}
-	// Get the file from the form and open it.
-	file, handler, err := r.FormFile(formName)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return err
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	var stored []StoredObject
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			response.Error(w, err.Error(), uint16(statusForBodyError(err, http.StatusInternalServerError)))
+			return err
+		}
+		if part.FormName() != formName {
+			part.Close()
+			continue
+		}
+		obj, err := h.storeFormPart(w, r, part)
+		part.Close()
+		if err != nil {
+			return err // The error response was already written by storeFormPart.
+		}
+		stored = append(stored, obj)
 	}
-	defer file.Close()
-	path := uploadDir + handler.Filename
-	// Write the form file to a new file.
-	if err := handleFile(w, path, file); err != nil {
+	if len(stored) == 0 {
+		err := http.ErrMissingFile
+		response.Error(w, err.Error(), http.StatusInternalServerError)
 		return err
 	}
-	return nil
+	return writeStoredResponse(w, stored)
+}
+
+// storeFormPart validates and stores a single form file part, writing an
+// error response and returning the error if validation or storage fails.
+func (h *Handler) storeFormPart(w http.ResponseWriter, r *http.Request, part *multipart.Part) (StoredObject, error) {
+	key, meta, body, err := h.validateUpload(part.FileName(), part.Header.Get("Content-Type"), part)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return StoredObject{}, err
+	}
+	stored, err := h.storeOne(r.Context(), key, body, meta)
+	if err != nil {
+		response.Error(w, err.Error(), uint16(statusForBodyError(err, http.StatusInternalServerError)))
+		return StoredObject{}, err
+	}
+	return stored, nil
 }
 
 // Handles POST requests of non-form-data media to the API.
-func handleOther(w http.ResponseWriter, r *http.Request) error {
+func (h *Handler) handleOther(w http.ResponseWriter, r *http.Request) error {
 	// Check if the media type is different from multipart/form-data
 	// as that should have been handled beforehand.
 	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
@@ -90,73 +221,408 @@ func handleOther(w http.ResponseWriter, r *http.Request) error {
 	// To provide an extension to the file name,
 	// we will use the file extension
 	// which matches the content-type header.
-	// WE do NOT use http.DetectContentType here,
-	// as that requires us to read from the body,
-	// which would remove those read bytes from the io.Reader.
 	contentType := r.Header.Get("Content-Type")
-	typeCandidates, err := mime.ExtensionsByType(contentType)
+	ext, err := extensionForContentType(contentType)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	// generate a random UUID for the file name.
+	key, meta, body, err := h.validateUpload(uuid.NewString()+ext, contentType, r.Body)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err.Error(), http.StatusUnsupportedMediaType)
 		return err
 	}
-	var ext string
-	if len(typeCandidates) > 0 {
-		preferred := strings.SplitAfter(contentType, "/")[1]
-		for _, candidate := range typeCandidates {
-			// Match with the preferred one.
-			if strings.HasSuffix(candidate, preferred) {
-				ext = candidate
-				break
-			}
+	// Store the request body under the generated key.
+	return h.put(w, r, key, body, meta)
+}
+
+// extensionForContentType returns the file extension mime.ExtensionsByType
+// reports for contentType that best matches its declared subtype, falling
+// back to its first candidate if none match. It returns "" if contentType is
+// unregistered, and an error if contentType cannot be parsed, as when it is
+// empty.
+func extensionForContentType(contentType string) (string, error) {
+	typeCandidates, err := mime.ExtensionsByType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if len(typeCandidates) == 0 {
+		return "", nil
+	}
+	preferred := strings.SplitAfter(contentType, "/")[1]
+	for _, candidate := range typeCandidates {
+		// Match with the preferred one.
+		if strings.HasSuffix(candidate, preferred) {
+			return candidate, nil
 		}
-		// If none matched, use the first one.
-		if ext == "" {
-			ext = typeCandidates[0]
+	}
+	// If none matched, use the first one.
+	return typeCandidates[0], nil
+}
+
+// sniffContentType reads up to sniffPrefixSize bytes from r to detect its
+// MIME type via http.DetectContentType, without buffering the rest of r. It
+// returns that type along with a reader that reproduces r's full contents,
+// sniffed bytes included.
+func sniffContentType(r io.Reader) (string, io.Reader, error) {
+	buf := make([]byte, sniffPrefixSize)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", nil, err
+	}
+	return http.DetectContentType(buf[:n]), io.MultiReader(bytes.NewReader(buf[:n]), r), nil
+}
+
+// validateUpload sanitizes name per h.config, sniffs body's actual content
+// type, and, if h.config.AllowedMIMETypes is set, rejects the upload unless
+// both the declared and sniffed types are allowed. It returns the storage
+// key h.config.RenamePolicy assigns, the ObjectMeta to store it with, and a
+// reader that reproduces body in full.
+func (h *Handler) validateUpload(name, declaredMIME string, body io.Reader) (string, ObjectMeta, io.Reader, error) {
+	if h.config.SanitizeFilename {
+		name = sanitizeFilename(name)
+	}
+	detectedMIME, body, err := sniffContentType(body)
+	if err != nil {
+		return "", ObjectMeta{}, nil, fmt.Errorf("upload: sniffing content type: %w", err)
+	}
+	if allowed := h.config.AllowedMIMETypes; len(allowed) > 0 {
+		if !mimeTypeAllowed(declaredMIME, allowed) {
+			return "", ObjectMeta{}, nil, fmt.Errorf("upload: declared content type %q not allowed", declaredMIME)
+		}
+		if !mimeTypeAllowed(detectedMIME, allowed) {
+			return "", ObjectMeta{}, nil, fmt.Errorf("upload: content sniffed as %q, not allowed (declared %q)", detectedMIME, declaredMIME)
 		}
 	}
-	// generate a random UUID for the file name.
-	uuid := uuid.NewString()
-	path := uploadDir + uuid + ext
-	// Write the request body to a new file.
-	if err := handleFile(w, path, r.Body); err != nil {
-		return err
+	policy := h.config.RenamePolicy
+	if policy == nil {
+		policy = Keep
 	}
-	return nil
+	return policy(name, detectedMIME), ObjectMeta{MimeType: detectedMIME}, body, nil
 }
 
-// Re-usable file handling function which takes care of
-// writing a container's content to a new file in the upload directory.
-// If the directory does not exist, it is created.
-func handleFile(w http.ResponseWriter, filePath string, container io.ReadCloser) error {
-	// Create the upload directory if it does not exist yet.
-	if err := createUploadDir(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return err
+// statusForBodyError returns http.StatusRequestEntityTooLarge if err wraps
+// an http.MaxBytesError raised by Config.MaxFileSize's cap, or fallback
+// otherwise.
+func statusForBodyError(err error, fallback int) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
 	}
-	// Create a new file in the upload directory.
-	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0666)
+	return fallback
+}
+
+// put stores body under key via the handler's Storage and writes the
+// resulting file information to the response as a response.JsonDto.
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, key string, body io.Reader, meta ObjectMeta) error {
+	stored, err := h.storeOne(r.Context(), key, body, meta)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		response.Error(w, err.Error(), uint16(statusForBodyError(err, http.StatusInternalServerError)))
 		return err
 	}
-	defer f.Close()
-	// Copy the container's content to the new file.
-	if _, err := io.Copy(f, container); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return err
+	return writeStoredResponse(w, []StoredObject{stored})
+}
+
+// storeOne stores body under key via the handler's Storage, generating a
+// zip metadata sidecar alongside it if it is one, and returns the resulting
+// StoredObject.
+func (h *Handler) storeOne(ctx context.Context, key string, body io.Reader, meta ObjectMeta) (StoredObject, error) {
+	stored, err := h.store.Put(ctx, key, body, meta)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	if stored.MimeType == zipMimeType {
+		// The metadata sidecar is an auxiliary convenience for the archive
+		// entry endpoints below; failing to generate it should not fail the
+		// upload itself.
+		if err := h.generateArchiveMeta(ctx, stored.Key); err != nil {
+			log.Printf("upload: generating archive metadata for %q: %v", stored.Key, err)
+		}
+	}
+	return stored, nil
+}
+
+// writeStoredResponse writes stored to the response as a response.JsonDto:
+// File is set to the first entry, for callers that only ever store one, and
+// Files carries every one, in order.
+func writeStoredResponse(w http.ResponseWriter, stored []StoredObject) error {
+	dtos := make([]*response.FileDto, len(stored))
+	for i, s := range stored {
+		dto := response.NewFileDto(s.Key)
+		dto.URL = s.URL
+		dtos[i] = dto
 	}
-	// Set an appropriate status code and return.
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	return nil
+	return json.NewEncoder(w).Encode(&response.JsonDto{
+		Status:  http.StatusCreated,
+		Message: http.StatusText(http.StatusCreated),
+		File:    dtos[0],
+		Files:   dtos,
+	})
+}
+
+// handleGet serves GET requests to the API: a request for ApiUrl itself
+// returns a ListDto of the objects found under the "prefix" query parameter,
+// a request for ApiUrl+key+entrySuffix extracts one entry of that archive,
+// and any other request for ApiUrl+key streams that object back, honoring
+// Range requests.
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, ApiUrl)
+	if key == "" {
+		h.handleList(w, r)
+		return
+	}
+	if archiveKey, ok := strings.CutSuffix(key, entrySuffix); ok {
+		h.handleArchiveEntry(w, r, archiveKey)
+		return
+	}
+	h.handleDownload(w, r, key)
+}
+
+// handleHead serves HEAD requests to the API, writing the same metadata
+// headers handleDownload would, but without a body.
+func (h *Handler) handleHead(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, ApiUrl)
+	if key == "" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	meta, err := h.store.Stat(r.Context(), key)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeMetaHeaders(w, meta)
+	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+}
+
+// handleList writes a JSON listing of the objects found under the "prefix"
+// query parameter to the response, in the style of the Ethereum Swarm HTTP
+// API: entries found directly under prefix, plus any pseudo-directories
+// derived from "/" separators in deeper keys.
+func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
+	result, err := h.store.List(r.Context(), r.URL.Query().Get(prefixParam))
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dto := response.ListDto{CommonPrefixes: result.CommonPrefixes}
+	for _, entry := range result.Entries {
+		dto.Entries = append(dto.Entries, response.EntryDto{
+			Name:       entry.Key,
+			Size:       entry.Size,
+			MimeType:   entry.MimeType,
+			SHA256:     entry.SHA256,
+			UploadTime: entry.ModTime,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&dto); err != nil {
+		response.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
-// Creates the upload directory if it does not exist yet.
-func createUploadDir() error {
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		err := os.Mkdir(uploadDir, 0777)
+// handleDownload streams the object stored under key back to the client,
+// honoring Range requests. If the Storage backend implements RangeOpener,
+// Range support is served through it via http.ServeContent, the same
+// mechanism openReaderAt uses for archive entries; otherwise, http.ServeContent
+// is used directly if the backend's Open reader also implements io.Seeker
+// (true of localfs's *os.File); failing both, the object is copied to the
+// response as-is, without Range support.
+func (h *Handler) handleDownload(w http.ResponseWriter, r *http.Request, key string) {
+	if ro, ok := h.store.(RangeOpener); ok {
+		meta, err := h.store.Stat(r.Context(), key)
 		if err != nil {
-			return err
+			response.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeMetaHeaders(w, meta)
+		sr := io.NewSectionReader(&rangeReaderAt{ctx: r.Context(), opener: ro, key: key}, 0, meta.Size)
+		http.ServeContent(w, r, key, meta.ModTime, sr)
+		return
+	}
+	rc, meta, err := h.store.Open(r.Context(), key)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+	writeMetaHeaders(w, meta)
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, meta.ModTime, rs)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(meta.Size, 10))
+	io.Copy(w, rc)
+}
+
+// writeMetaHeaders sets the response headers derived from meta that both
+// handleDownload and handleHead expose: Content-Type and an ETag based on
+// the object's content hash, if the backend provides one.
+func writeMetaHeaders(w http.ResponseWriter, meta ObjectMeta) {
+	if meta.MimeType != "" {
+		w.Header().Set("Content-Type", meta.MimeType)
+	}
+	if meta.SHA256 != "" {
+		w.Header().Set("ETag", `"`+meta.SHA256+`"`)
+	}
+}
+
+// handleArchiveEntry serves GET requests for ApiUrl+key+entrySuffix: it
+// opens the zip archive stored under key, locates the entry named by the
+// base64url-encoded "path" query parameter, and streams its decompressed
+// contents back with a Content-Disposition attachment header.
+func (h *Handler) handleArchiveEntry(w http.ResponseWriter, r *http.Request, key string) {
+	entryPath, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get(entryPathParam))
+	if err != nil {
+		response.Error(w, "invalid path: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	ra, size, closer, err := h.openReaderAt(r.Context(), key)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer closer.Close()
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc, f, err := archive.ExtractEntry(zr, string(entryPath))
+	if err != nil {
+		response.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+	name := path.Base(f.Name)
+	if mimeType := mime.TypeByExtension(filepath.Ext(name)); mimeType != "" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(name))
+	w.Header().Set("Content-Length", strconv.FormatUint(f.UncompressedSize64, 10))
+	io.Copy(w, rc)
+}
+
+// generateArchiveMeta parses the zip archive stored under key and writes an
+// archive.GenerateMeta sidecar for it back to the store, under
+// key+archive.MetaSuffix.
+func (h *Handler) generateArchiveMeta(ctx context.Context, key string) error {
+	ra, size, closer, err := h.openReaderAt(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return fmt.Errorf("upload: opening %q as zip: %w", key, err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(archive.GenerateMeta(pw, zr))
+	}()
+	_, err = h.store.Put(ctx, key+archive.MetaSuffix, pr, ObjectMeta{MimeType: "application/gzip"})
+	return err
+}
+
+// openReaderAt returns an io.ReaderAt over the object stored under key,
+// along with its size and a Closer to release any resources it holds. If
+// the store implements RangeOpener, the returned reader serves ReadAt calls
+// via ranged reads, avoiding buffering the whole object; otherwise, the
+// store's own Open is used, which must return a reader that also implements
+// io.ReaderAt (as localfs.Storage's does).
+func (h *Handler) openReaderAt(ctx context.Context, key string) (io.ReaderAt, int64, io.Closer, error) {
+	if ro, ok := h.store.(RangeOpener); ok {
+		meta, err := h.store.Stat(ctx, key)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return &rangeReaderAt{ctx: ctx, opener: ro, key: key}, meta.Size, io.NopCloser(nil), nil
+	}
+	rc, meta, err := h.store.Open(ctx, key)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	ra, ok := rc.(io.ReaderAt)
+	if !ok {
+		rc.Close()
+		return nil, 0, nil, fmt.Errorf("upload: storage backend for %q supports neither ranged reads nor io.ReaderAt", key)
+	}
+	return ra, meta.Size, rc, nil
+}
+
+// rangeReaderAt adapts a RangeOpener's ranged GET requests to the
+// io.ReaderAt interface archive/zip.NewReader requires, for backends (like
+// s3.Storage) whose Open does not return a seekable reader.
+type rangeReaderAt struct {
+	ctx    context.Context
+	opener RangeOpener
+	key    string
+}
+
+// ReadAt implements io.ReaderAt by requesting the byte range [off, off+len(p))
+// from the underlying RangeOpener.
+func (r *rangeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	rc, err := r.opener.OpenRange(r.ctx, r.key, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.ReadFull(rc, p)
+}
+
+// contentDisposition returns an "attachment" Content-Disposition header
+// value for name, adding an RFC 5987 "filename*" parameter with a
+// percent-encoded UTF-8 value when name contains non-ASCII characters, since
+// the plain "filename" parameter is not well-defined for those.
+func contentDisposition(name string) string {
+	if isASCII(name) {
+		return fmt.Sprintf(`attachment; filename="%s"`, name)
+	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, asciiFallback(name), rfc5987Encode(name))
+}
+
+// isASCII reports whether s contains only ASCII characters.
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiFallback replaces every non-ASCII character in s with "_", for use as
+// the plain "filename" parameter alongside an RFC 5987 "filename*" one.
+func asciiFallback(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// rfc5987AttrChars are the octets RFC 5987's "attr-char" leaves unescaped;
+// everything else must be percent-encoded.
+const rfc5987AttrChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$&+-.^_`|~"
+
+// rfc5987Encode percent-encodes s per RFC 5987's ext-value grammar, for use
+// in a Content-Disposition "filename*" parameter.
+func rfc5987Encode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if strings.IndexByte(rfc5987AttrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
 		}
 	}
-	return nil
+	return b.String()
 }
@@ -2,18 +2,29 @@
 package upload_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/quick"
 
+	"github.com/christowolf/server-playground/response"
 	"github.com/christowolf/server-playground/upload"
+	"github.com/christowolf/server-playground/upload/archive"
+	"github.com/christowolf/server-playground/upload/localfs"
 )
 
 const (
@@ -24,10 +35,9 @@ const (
 // TestApiEndpointForm tests the upload API endpoint by posting a form containing a file.
 func TestApiEndpointHandlerForm(t *testing.T) {
 	// t.Parallel()
+	dir := t.TempDir()
 	fileName := "test.txt"
-	expectedPath := upload.UploadDir + fileName
-	// Register the file cleanup.
-	fileCleanup(t, expectedPath)
+	expectedPath := filepath.Join(dir, fileName)
 	testContent := "test content form"
 	// Create a new request.
 	// For this, we also need an appropriate request body,
@@ -43,7 +53,7 @@ func TestApiEndpointHandlerForm(t *testing.T) {
 	// Create a new recorder.
 	w := httptest.NewRecorder()
 	// Call the API endpoint.
-	sut := upload.ApiEndpoint()
+	sut := newTestHandler(t, dir)
 	sut.ServeHTTP(w, r)
 	// Check the response code.
 	if w.Code != http.StatusCreated {
@@ -63,12 +73,56 @@ func TestApiEndpointHandlerForm(t *testing.T) {
 	}
 }
 
+// TestApiEndpointHandlerFormMultipleFiles tests that a single multipart
+// request containing several "file" parts stores every one of them, not
+// just the first.
+func TestApiEndpointHandlerFormMultipleFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string]string{"first.txt": "first content", "second.txt": "second content"}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for _, name := range []string{"first.txt", "second.txt"} {
+		fileWriter, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		io.Copy(fileWriter, strings.NewReader(files[name]))
+	}
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com"+uri, body)
+	r.Header.Add("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	sut := newTestHandler(t, dir)
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusCreated, w.Code)
+	}
+	var got response.JsonDto
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(got.Files) != 2 {
+		t.Fatalf("expected two stored files, got: %v", got.Files)
+	}
+	if got.File == nil || got.File.Name != got.Files[0].Name {
+		t.Errorf("expected File to match Files[0], got: %v, %v", got.File, got.Files[0])
+	}
+	for name, content := range files {
+		gotContent, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expected file %v to exist, got error: %v", name, err)
+		}
+		if string(gotContent) != content {
+			t.Errorf("expected file %v content: %v, got: %v", name, content, string(gotContent))
+		}
+	}
+}
+
 // TestApiEndpointForm tests the upload API endpoint by posting binary content.
 func TestApiEndpointHandlerOther(t *testing.T) {
+	dir := t.TempDir()
 	fileName := "test.txt"
-	expectedPath := upload.UploadDir + fileName
-	// Register the file cleanup.
-	fileCleanup(t, expectedPath)
 	testContent := "test content binary"
 	// Create a new request.
 	// For this, we also need an appropriate request body
@@ -80,12 +134,21 @@ func TestApiEndpointHandlerOther(t *testing.T) {
 	// Create a new recorder.
 	w := httptest.NewRecorder()
 	// Call the API endpoint.
-	sut := upload.ApiEndpoint()
+	sut := newTestHandler(t, dir)
 	sut.ServeHTTP(w, r)
 	// Check the response code.
 	if w.Code != http.StatusCreated {
 		t.Errorf("expected status code: %v, got: %v", http.StatusCreated, w.Code)
 	}
+	// The file name is generated server-side, so read it back from the response.
+	var got response.JsonDto
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if got.File == nil {
+		t.Fatalf("expected a file in the response, got: %v", got)
+	}
+	expectedPath := filepath.Join(dir, got.File.Name)
 	// Check if the file was uploaded correctly.
 	if _, err := os.Stat(expectedPath); err != nil {
 		t.Fatalf("expected file: %v, got error: %v", expectedPath, err)
@@ -100,13 +163,525 @@ func TestApiEndpointHandlerOther(t *testing.T) {
 	}
 }
 
-// fileCleanup executes file cleanup after test execution.
-// If an error is encountered during os.Remove,
-// it is communicated to the testing.T instance.
-func fileCleanup(t *testing.T, path string) {
-	t.Cleanup(func() {
-		if err := os.Remove(path); err != nil {
-			t.Errorf("cleanup failed for file: %v, got error: %v", path, err)
-		}
+// TestApiEndpointHandlerDownload tests that a GET request for a stored
+// object's key streams its content back, along with metadata headers, and
+// that a Range request returns partial content.
+func TestApiEndpointHandlerDownload(t *testing.T) {
+	dir := t.TempDir()
+	key, content := "test.txt", "test content download"
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store)
+	putFile(t, store, key, content)
+
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key, nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusOK, w.Code)
+	}
+	if w.Body.String() != content {
+		t.Errorf("expected body: %v, got: %v", content, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+		t.Errorf("expected content type: %v, got: %v", "text/plain; charset=utf-8", got)
+	}
+	if got := w.Header().Get("ETag"); got == "" {
+		t.Error("expected a non-empty ETag")
+	}
+
+	// Range requests should be honored, since localfs.Storage's reader
+	// supports seeking.
+	r = httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key, nil)
+	r.Header.Set("Range", "bytes=0-3")
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusPartialContent, w.Code)
+	}
+	if w.Body.String() != content[:4] {
+		t.Errorf("expected body: %v, got: %v", content[:4], w.Body.String())
+	}
+}
+
+// TestApiEndpointHandlerDownloadRangeViaRangeOpener tests that Range requests
+// are honored through a Storage's RangeOpener even when its Open reader does
+// not support seeking, the situation s3.Storage is in.
+func TestApiEndpointHandlerDownloadRangeViaRangeOpener(t *testing.T) {
+	dir := t.TempDir()
+	key, content := "test.txt", "range via RangeOpener"
+	store := rangeOnlyStorage{newTestStorage(t, dir)}
+	sut := upload.NewHandler(store)
+	putFile(t, store, key, content)
+
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key, nil)
+	r.Header.Set("Range", "bytes=0-4")
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusPartialContent, w.Code)
+	}
+	if w.Body.String() != content[:5] {
+		t.Errorf("expected body: %v, got: %v", content[:5], w.Body.String())
+	}
+}
+
+// rangeOnlyStorage wraps a Storage, hiding any io.Seeker its Open reader
+// might implement and serving ranges only through RangeOpener instead, the
+// way s3.Storage does. This lets tests exercise handleDownload's RangeOpener
+// path without a real S3 backend.
+type rangeOnlyStorage struct {
+	upload.Storage
+}
+
+// nonSeekableReadCloser hides any io.Seeker a wrapped io.ReadCloser might
+// implement.
+type nonSeekableReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Open returns a reader that is never an io.Seeker, forcing handleDownload
+// to rely on RangeOpener for Range support.
+func (s rangeOnlyStorage) Open(ctx context.Context, key string) (io.ReadCloser, upload.ObjectMeta, error) {
+	rc, meta, err := s.Storage.Open(ctx, key)
+	if err != nil {
+		return nil, upload.ObjectMeta{}, err
+	}
+	return nonSeekableReadCloser{rc, rc}, meta, nil
+}
+
+// OpenRange implements upload.RangeOpener by opening the full object and
+// discarding the bytes outside [offset, offset+length).
+func (s rangeOnlyStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	rc, _, err := s.Storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return nonSeekableReadCloser{io.LimitReader(rc, length), rc}, nil
+}
+
+// TestApiEndpointHandlerHead tests that a HEAD request for a stored object's
+// key returns the same metadata headers a GET would, without a body.
+func TestApiEndpointHandlerHead(t *testing.T) {
+	dir := t.TempDir()
+	key, content := "test.txt", "test content head"
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store)
+	putFile(t, store, key, content)
+
+	r := httptest.NewRequest(http.MethodHead, "http://testdomain.com"+uri+key, nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusOK, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected no body, got: %v", w.Body.String())
+	}
+	if got := w.Header().Get("ETag"); got == "" {
+		t.Error("expected a non-empty ETag")
+	}
+	if got := w.Header().Get("Content-Length"); got != fmt.Sprint(len(content)) {
+		t.Errorf("expected content length: %v, got: %v", len(content), got)
+	}
+}
+
+// TestApiEndpointHandlerList tests that a GET request for a prefix returns a
+// JSON listing of the entries found directly under it, and the
+// pseudo-directories found deeper.
+func TestApiEndpointHandlerList(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store)
+	putFile(t, store, "reports/a.txt", "a")
+	putFile(t, store, "reports/2024/b.txt", "b")
+
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+"?prefix=reports/", nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusOK, w.Code)
+	}
+	var got response.ListDto
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if len(got.Entries) != 1 || got.Entries[0].Name != "reports/a.txt" {
+		t.Errorf("expected a single entry: %v, got: %v", "reports/a.txt", got.Entries)
+	}
+	if len(got.CommonPrefixes) != 1 || got.CommonPrefixes[0] != "reports/2024/" {
+		t.Errorf("expected a single common prefix: %v, got: %v", "reports/2024/", got.CommonPrefixes)
+	}
+}
+
+// TestApiEndpointHandlerDownloadRoundTripProperty applies property based
+// testing to check that arbitrary content posted to the API is returned
+// unchanged by a subsequent GET for the same key.
+func TestApiEndpointHandlerDownloadRoundTripProperty(t *testing.T) {
+	t.Parallel()
+	c := &quick.Config{MaxCount: 1000}
+	f := func(content []byte) bool {
+		dir := t.TempDir()
+		store := newTestStorage(t, dir)
+		sut := upload.NewHandler(store)
+		putFile(t, store, "test.bin", string(content))
+
+		r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+"test.bin", nil)
+		w := httptest.NewRecorder()
+		sut.ServeHTTP(w, r)
+		return w.Code == http.StatusOK && bytes.Equal(w.Body.Bytes(), content)
+	}
+	if err := quick.Check(f, c); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestApiEndpointHandlerPostZipGeneratesMeta tests that posting a zip file
+// generates a metadata sidecar alongside it, listing its entries.
+func TestApiEndpointHandlerPostZipGeneratesMeta(t *testing.T) {
+	dir := t.TempDir()
+	sut := newTestHandler(t, dir)
+	key := postZip(t, sut, map[string]string{
+		"a.txt":        "a content",
+		"nested/b.txt": "b content",
+		"非ASCII名前.txt": "unicode content",
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key+archive.MetaSuffix, nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusOK, w.Code)
+	}
+	entries, err := archive.ReadMeta(w.Body)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got: %v", entries)
+	}
+}
+
+// TestApiEndpointHandlerPostZipGeneratesMetaWithoutZipExtension tests that a
+// zip file stored under a key without a ".zip" extension -- e.g. because a
+// RenamePolicy dropped it -- still gets its metadata sidecar generated,
+// since that decision is driven by the upload's sniffed content type, not
+// its stored key's extension.
+func TestApiEndpointHandlerPostZipGeneratesMetaWithoutZipExtension(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStorage(t, dir)
+	stripExt := upload.RenamePolicy(func(name, _ string) string {
+		return strings.TrimSuffix(name, filepath.Ext(name))
 	})
+	sut := upload.NewHandler(store, upload.WithConfig(upload.Config{
+		RenamePolicy:     stripExt,
+		SanitizeFilename: true,
+	}))
+	key := postZip(t, sut, map[string]string{"a.txt": "a content"})
+	if filepath.Ext(key) == ".zip" {
+		t.Fatalf("expected the RenamePolicy to have dropped the .zip extension, got key: %v", key)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key+archive.MetaSuffix, nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusOK, w.Code)
+	}
+	entries, err := archive.ReadMeta(w.Body)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got: %v", entries)
+	}
+}
+
+// TestApiEndpointHandlerArchiveEntry tests extracting a nested, non-ASCII
+// named entry from a stored zip file via the GET .../entry endpoint.
+func TestApiEndpointHandlerArchiveEntry(t *testing.T) {
+	dir := t.TempDir()
+	sut := newTestHandler(t, dir)
+	want := "unicode content"
+	entryPath := "nested/非ASCII名前.txt"
+	key := postZip(t, sut, map[string]string{entryPath: want})
+
+	encodedPath := base64.RawURLEncoding.EncodeToString([]byte(entryPath))
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key+"/entry?"+url.Values{"path": {encodedPath}}.Encode(), nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusOK, w.Code)
+	}
+	if w.Body.String() != want {
+		t.Errorf("expected body: %v, got: %v", want, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, "filename*=UTF-8''") {
+		t.Errorf("expected an RFC 5987 filename* parameter, got: %v", got)
+	}
+}
+
+// TestApiEndpointHandlerArchiveEntryZipSlip tests that a zip-slip entry path
+// is rejected rather than extracted.
+func TestApiEndpointHandlerArchiveEntryZipSlip(t *testing.T) {
+	dir := t.TempDir()
+	sut := newTestHandler(t, dir)
+	key := postZip(t, sut, map[string]string{"a.txt": "a"})
+
+	encodedPath := base64.RawURLEncoding.EncodeToString([]byte("../../etc/passwd"))
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+key+"/entry?"+url.Values{"path": {encodedPath}}.Encode(), nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code == http.StatusOK {
+		t.Errorf("expected a non-200 status code for a zip-slip path, got: %v", w.Code)
+	}
+}
+
+// TestApiEndpointHandlerArchiveEntryTruncated tests that extracting an entry
+// from a truncated zip file fails cleanly rather than panicking.
+func TestApiEndpointHandlerArchiveEntryTruncated(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store)
+	full := zipBytes(t, map[string]string{"a.txt": "a"})
+	truncated := full[:len(full)/2]
+	putFile(t, store, "truncated.zip", string(truncated))
+
+	encodedPath := base64.RawURLEncoding.EncodeToString([]byte("a.txt"))
+	r := httptest.NewRequest(http.MethodGet, "http://testdomain.com"+uri+"truncated.zip/entry?"+url.Values{"path": {encodedPath}}.Encode(), nil)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code == http.StatusOK {
+		t.Errorf("expected a non-200 status code for a truncated archive, got: %v", w.Code)
+	}
+}
+
+// zipBytes returns an in-memory zip archive containing the given path ->
+// content entries.
+func zipBytes(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for path, content := range entries {
+		fw, err := zw.Create(path)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// postZip posts a zip archive built from entries to sut as a multipart form
+// upload, returning the key it was stored under.
+func postZip(t *testing.T, sut http.Handler, entries map[string]string) string {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileWriter, err := writer.CreateFormFile("file", "archive.zip")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if _, err := fileWriter.Write(zipBytes(t, entries)); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com"+uri, body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusCreated, w.Code)
+	}
+	var got response.JsonDto
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if got.File == nil {
+		t.Fatalf("expected a file in the response, got: %v", got)
+	}
+	return got.File.Name
+}
+
+// TestApiEndpointHandlerRejectsPathTraversal tests that a form file whose
+// name attempts a path traversal is stored under a sanitized name confined
+// to the storage directory, rather than escaping it.
+func TestApiEndpointHandlerRejectsPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	sut := newTestHandler(t, dir)
+	testContent := "malicious content"
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileWriter, err := writer.CreateFormFile("file", "../../etc/passwd")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	io.Copy(fileWriter, strings.NewReader(testContent))
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com"+uri, body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusCreated, w.Code)
+	}
+	var got response.JsonDto
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if got.File == nil || strings.ContainsAny(got.File.Name, "/\\") {
+		t.Fatalf("expected a sanitized, traversal-free file name, got: %v", got.File)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "passwd")); err != nil {
+		t.Errorf("expected the sanitized file, got error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "etc", "passwd")); err == nil {
+		t.Error("expected no file to have escaped the storage directory")
+	}
+}
+
+// TestApiEndpointHandlerAllowedMIMETypes tests that Config.AllowedMIMETypes
+// accepts a matching upload and rejects a mismatched one, regardless of what
+// Content-Type the client declares.
+func TestApiEndpointHandlerAllowedMIMETypes(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store, upload.WithConfig(upload.Config{
+		AllowedMIMETypes: []string{"text/plain"},
+		RenamePolicy:     upload.Keep,
+		SanitizeFilename: true,
+	}))
+
+	post := func(fileName, declaredMIME, content string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, fileName))
+		header.Set("Content-Type", declaredMIME)
+		fileWriter, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		io.Copy(fileWriter, strings.NewReader(content))
+		writer.Close()
+		r := httptest.NewRequest(http.MethodPost, "http://testdomain.com"+uri, body)
+		r.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		sut.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post("report.txt", "text/plain", "plain text content"); w.Code != http.StatusCreated {
+		t.Errorf("expected status code: %v, got: %v (%v)", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := post("image.png", "image/png", "\x89PNG\r\n\x1a\n"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status code: %v, got: %v", http.StatusUnsupportedMediaType, w.Code)
+	}
+	// A PNG signature declared as text/plain: the sniffed type must still be
+	// caught by the allowlist, even though the declared one passes.
+	pngSignature := "\x89PNG\r\n\x1a\n"
+	if w := post("image.txt", "text/plain", pngSignature); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status code: %v, got: %v", http.StatusUnsupportedMediaType, w.Code)
+	}
+}
+
+// TestApiEndpointHandlerMaxFileSize tests that Config.MaxFileSize rejects an
+// upload whose body exceeds the cap with 413 Request Entity Too Large.
+func TestApiEndpointHandlerMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store, upload.WithConfig(upload.Config{
+		MaxFileSize:      4,
+		RenamePolicy:     upload.Keep,
+		SanitizeFilename: true,
+	}))
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileWriter, err := writer.CreateFormFile("file", "report.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	io.Copy(fileWriter, strings.NewReader("this is far too much content"))
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com"+uri, body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status code: %v, got: %v", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+// TestApiEndpointHandlerRenamePolicy tests that Config.RenamePolicy decides
+// the key a form file is stored under.
+func TestApiEndpointHandlerRenamePolicy(t *testing.T) {
+	dir := t.TempDir()
+	store := newTestStorage(t, dir)
+	sut := upload.NewHandler(store, upload.WithConfig(upload.Config{
+		RenamePolicy:     upload.UUID,
+		SanitizeFilename: true,
+	}))
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fileWriter, err := writer.CreateFormFile("file", "report.txt")
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	io.Copy(fileWriter, strings.NewReader("content"))
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "http://testdomain.com"+uri, body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code: %v, got: %v", http.StatusCreated, w.Code)
+	}
+	var got response.JsonDto
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("expected valid JSON response, got error: %v", err)
+	}
+	if got.File == nil || got.File.Name == "report.txt" || filepath.Ext(got.File.Name) != ".txt" {
+		t.Errorf("expected a UUID-renamed file preserving its extension, got: %v", got.File)
+	}
+}
+
+// putFile stores content under key directly via store, since the API's own
+// POST endpoint derives the key itself, from the sanitized file name or a
+// generated UUID. This lets the GET/HEAD/List tests set up fixtures at keys
+// of their choosing.
+func putFile(t *testing.T, store upload.Storage, key, content string) {
+	t.Helper()
+	if _, err := store.Put(context.Background(), key, strings.NewReader(content), upload.ObjectMeta{
+		MimeType: mime.TypeByExtension(filepath.Ext(key)),
+	}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+}
+
+// newTestHandler returns an upload API handler backed by a localfs.Storage
+// rooted at dir.
+func newTestHandler(t *testing.T, dir string) http.Handler {
+	t.Helper()
+	return upload.NewHandler(newTestStorage(t, dir))
+}
+
+// newTestStorage returns a localfs.Storage rooted at dir.
+func newTestStorage(t *testing.T, dir string) *localfs.Storage {
+	t.Helper()
+	store, err := localfs.New(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	return store
 }